@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchResult is the outcome of looking up a single album of a batch.
+type BatchResult struct {
+	Query string
+	Info  *AlbumInfo
+	Err   error
+
+	// Cached is set if the same query appeared earlier in the batch and its
+	// result was reused.
+	Cached bool
+
+	// Skipped is set if the album wasn't looked up because of WithSkip. Info
+	// and Err are nil then.
+	Skipped bool
+
+	query artistAlbum
+}
+
+// Genres returns scraped genres or an empty slice if lookup failed.
+func (r BatchResult) Genres() []string {
+	if r.Info == nil {
+		return []string{}
+	}
+	return r.Info.Genres
+}
+
+// WithSkip makes batch lookups skip albums for which skip returns true, e.g.
+// ones already tagged, marking their results as Skipped. Single album
+// lookups are unaffected. For pages of BatchGenresFromURL, artist is empty
+// and album is the URL.
+func WithSkip(skip func(artist, album string) bool) Option {
+	return func(c *Client) {
+		c.skip = skip
+	}
+}
+
+// BatchAlbumGenres looks up multiple albums using DefaultClient.
+func BatchAlbumGenres(queries []string) []BatchResult {
+	return DefaultClient.BatchAlbumGenres(queries)
+}
+
+// BatchAlbumGenres looks up multiple albums given as "[ARTIST - ]ALBUM"
+// concurrently. Results, including errors, are in the same order as queries
+// no matter in which order lookups complete.
+//
+// Once a lookup fails with a fatal error, i.e. a BlockedError or an HTTPError
+// whose Fatal method returns true, there's no point in sending more requests:
+// lookups still running are given up and the rest aren't started, all of
+// them failing with the same error.
+func (c *Client) BatchAlbumGenres(queries []string) []BatchResult {
+	return c.lookupAlbums(context.Background(), artistAlbumsFromCLI(queries))
+}
+
+// BatchAlbumGenresContext is like BatchAlbumGenres but gives up lookups still
+// running when ctx is done. Albums looked up by then keep their results, the
+// rest fail with the error of ctx.
+func (c *Client) BatchAlbumGenresContext(ctx context.Context, queries []string) []BatchResult {
+	return c.lookupAlbums(ctx, artistAlbumsFromCLI(queries))
+}
+
+// BatchAlbumGenresMap looks up multiple albums using DefaultClient and maps
+// queries to genres.
+func BatchAlbumGenresMap(queries []string) (map[string][]string, []error) {
+	return DefaultClient.BatchAlbumGenresMap(queries)
+}
+
+// BatchAlbumGenresMap is like BatchAlbumGenres but maps queries as given to
+// genres. Repeated queries collapse into a single entry. Albums without
+// genres are left out of the map, and the errors explain why, in the order of
+// queries. Albums skipped because of WithSkip are left out without an error.
+func (c *Client) BatchAlbumGenresMap(queries []string) (map[string][]string, []error) {
+	result := make(map[string][]string)
+	var errs []error
+	for _, r := range c.BatchAlbumGenres(queries) {
+		if r.Cached || r.Query == "" {
+			continue
+		}
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("error finding genres for %s: %s", r.Query, r.Err))
+			continue
+		}
+		if r.Skipped || r.Info == nil {
+			continue
+		}
+		result[r.Query] = r.Info.Genres
+	}
+	return result, errs
+}
+
+// lookupAlbums looks up albums concurrently. Identical queries are looked up
+// only once, and every position of a repeated query gets the same result with
+// Cached set on all but the first. Results are only assembled after all
+// lookups are done, so a repeated query never sees a lookup in flight. Results
+// are in the same order as queries, empty queries yield empty results.
+func (c *Client) lookupAlbums(ctx context.Context, as []artistAlbum) []BatchResult {
+	return c.lookupAlbumsFunc(ctx, as, c.searchLookup, nil)
+}
+
+// lookupAlbumsFunc is like lookupAlbums but looks up albums with lookup and
+// also calls done, if given, with the result of each unique query as soon as
+// it's looked up. done is called from the goroutine that called
+// lookupAlbumsFunc, one result at a time, so it may change shared state
+// without locking.
+func (c *Client) lookupAlbumsFunc(ctx context.Context, as []artistAlbum, lookup albumLookup, done func(BatchResult)) []BatchResult {
+	ctx, halt := newBatchHalt(ctx)
+	defer halt.cancel()
+	finished := make(chan *BatchResult, len(as))
+	unique := make(map[artistAlbum]*BatchResult)
+	for _, aa := range as {
+		if aa == (artistAlbum{}) {
+			continue
+		}
+		if _, ok := unique[aa]; ok {
+			c.metrics.Increment("cache.hits")
+			continue
+		}
+		c.metrics.Increment("cache.misses")
+		r := &BatchResult{Query: aa.both, query: aa}
+		unique[aa] = r
+		go func() {
+			*r = c.lookupOne(ctx, r.query, lookup)
+			halt.check(r)
+			finished <- r
+		}()
+	}
+	for range unique {
+		r := <-finished
+		if done != nil {
+			done(*r)
+		}
+	}
+
+	result := make([]BatchResult, len(as))
+	seen := make(map[artistAlbum]bool)
+	for i, aa := range as {
+		r, ok := unique[aa]
+		if !ok {
+			result[i] = BatchResult{Query: aa.both, query: aa}
+			continue
+		}
+		result[i] = *r
+		result[i].Cached = seen[aa]
+		seen[aa] = true
+	}
+	return result
+}
+
+// albumLookup looks up a single album, e.g. searchLookup or urlLookup.
+type albumLookup func(ctx context.Context, aa artistAlbum) (*AlbumInfo, error)
+
+// searchLookup looks up aa by searching for it.
+func (c *Client) searchLookup(ctx context.Context, aa artistAlbum) (*AlbumInfo, error) {
+	return c.LookupAlbumContext(ctx, aa.artist, aa.album)
+}
+
+// urlLookup scrapes the page at the URL given as the album of aa.
+func (c *Client) urlLookup(ctx context.Context, aa artistAlbum) (*AlbumInfo, error) {
+	return c.urlInfo(ctx, aa.album)
+}
+
+// lookupOne looks up a single album of a batch with lookup. A panic during lookup is
+// turned into the error of the result, so that one malformed page doesn't
+// bring the whole batch down.
+func (c *Client) lookupOne(ctx context.Context, aa artistAlbum, lookup albumLookup) (r BatchResult) {
+	r = BatchResult{Query: aa.both, query: aa}
+	if aa == (artistAlbum{}) {
+		return r
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			r.Info = nil
+			r.Err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	if c.skip != nil && c.skip(aa.artist, aa.album) {
+		r.Skipped = true
+		return r
+	}
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	r.Info, r.Err = lookup(ctx, aa)
+	if r.Err != nil && ctx.Err() != nil {
+		// Report the timeout rather than the request it interrupted.
+		r.Err = ctx.Err()
+	}
+	return r
+}
+
+// batchHalt stops lookups of a batch once one of them fails with a fatal
+// error, see isFatal.
+type batchHalt struct {
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// newBatchHalt returns the context lookups of a batch must be run with.
+func newBatchHalt(ctx context.Context) (context.Context, *batchHalt) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &batchHalt{cancel: cancel}
+}
+
+// check halts the batch if r failed with a fatal error. If the batch was
+// halted already and r was given up because of that, its error is replaced
+// with the fatal one.
+func (h *batchHalt) check(r *BatchResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.err == nil && isFatal(r.Err):
+		h.err = r.Err
+		h.cancel()
+	case h.err != nil && r.Err == context.Canceled:
+		r.Err = h.err
+	}
+}
+
+// BatchGenresFromURL scrapes multiple album pages using DefaultClient.
+func BatchGenresFromURL(urls []string) []BatchResult {
+	return DefaultClient.BatchGenresFromURL(urls)
+}
+
+// BatchGenresFromURL scrapes album pages at urls concurrently like
+// GenresFromURL. Results are in the same order as urls, with Query set to the
+// URL. Repeated URLs are scraped only once, empty ones yield empty results.
+// Like with BatchAlbumGenres, WithSkip applies and a fatal error fails all
+// lookups after it.
+func (c *Client) BatchGenresFromURL(urls []string) []BatchResult {
+	return c.BatchGenresFromURLContext(context.Background(), urls)
+}
+
+// BatchGenresFromURLContext is like BatchGenresFromURL but gives up pages
+// still being scraped when ctx is done.
+func (c *Client) BatchGenresFromURLContext(ctx context.Context, urls []string) []BatchResult {
+	as := make([]artistAlbum, len(urls))
+	for i, uri := range urls {
+		as[i] = artistAlbum{"", uri, uri}
+	}
+	return c.lookupAlbumsFunc(ctx, as, c.urlLookup, nil)
+}
+
+// StreamAlbumGenres looks up albums using DefaultClient as they arrive.
+func StreamAlbumGenres(queries <-chan string, concurrency int) <-chan BatchResult {
+	return DefaultClient.StreamAlbumGenres(queries, concurrency)
+}
+
+// StreamAlbumGenres looks up albums given as "[ARTIST - ]ALBUM" as they
+// arrive from queries, with at most concurrency lookups in flight, and sends
+// results in the same order as queries to the returned channel. The channel is
+// closed after queries is closed and all results are sent. Unlike
+// BatchAlbumGenres, identical queries are looked up each time, so memory use
+// doesn't grow with the number of queries. Like with BatchAlbumGenres, a fatal
+// error fails all lookups after it.
+func (c *Client) StreamAlbumGenres(queries <-chan string, concurrency int) <-chan BatchResult {
+	as := make(chan artistAlbum)
+	go func() {
+		defer close(as)
+		for q := range queries {
+			as <- parsePlainItem(q)
+		}
+	}()
+	return c.streamAlbums(context.Background(), as, concurrency)
+}
+
+func (c *Client) streamAlbums(ctx context.Context, as <-chan artistAlbum, concurrency int) <-chan BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, halt := newBatchHalt(ctx)
+	// A slot is taken for each lookup in flight.
+	slots := make(chan struct{}, concurrency)
+	// Results of lookups, in input order.
+	pending := make(chan chan BatchResult, concurrency)
+	go func() {
+		defer close(pending)
+		for aa := range as {
+			slots <- struct{}{}
+			result := make(chan BatchResult, 1)
+			pending <- result
+			go func(aa artistAlbum) {
+				r := c.lookupOne(ctx, aa, c.searchLookup)
+				halt.check(&r)
+				result <- r
+				<-slots
+			}(aa)
+		}
+	}()
+
+	results := make(chan BatchResult)
+	go func() {
+		defer close(results)
+		defer halt.cancel()
+		for result := range pending {
+			results <- <-result
+		}
+	}()
+	return results
+}
+
+type batchStats struct {
+	total, resolved, notFound, errored, skipped, cacheHits int
+	requests                                               int64
+	elapsed                                                time.Duration
+}
+
+func summarize(results []BatchResult, requests int64, elapsed time.Duration) batchStats {
+	var stats batchStats
+	for _, r := range results {
+		stats.add(r)
+	}
+	stats.requests = requests
+	stats.elapsed = elapsed
+	return stats
+}
+
+func (s *batchStats) add(r BatchResult) {
+	s.total++
+	switch {
+	case r.Err == ErrNoGenres, r.Err == ErrLowConfidence, r.Err == ErrNotFound:
+		s.notFound++
+	case r.Err != nil:
+		s.errored++
+	case r.Info != nil:
+		s.resolved++
+	case r.Skipped:
+		s.skipped++
+	}
+	if r.Cached {
+		s.cacheHits++
+	}
+}
+
+func (s batchStats) String() string {
+	return fmt.Sprintf("%d queries: %d resolved, %d not found, %d errored, %d skipped, %d cache hits, %d requests in %s",
+		s.total, s.resolved, s.notFound, s.errored, s.skipped, s.cacheHits, s.requests, s.elapsed)
+}
+
+// GenreCounts counts how many albums of a batch have each genre. Genres are
+// lowercased so that differently cased spellings are counted together.
+// Repeated queries are counted once.
+func GenreCounts(results []BatchResult) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range results {
+		countGenres(counts, r)
+	}
+	return counts
+}
+
+func countGenres(counts map[string]int, r BatchResult) {
+	if r.Cached {
+		return
+	}
+	for _, g := range r.Genres() {
+		counts[strings.ToLower(g)]++
+	}
+}
+
+type genreCount struct {
+	genre string
+	count int
+}
+
+// topGenres returns at most n most frequent genres, most frequent first.
+func topGenres(counts map[string]int, n int) []genreCount {
+	var result []genreCount
+	for g, count := range counts {
+		result = append(result, genreCount{g, count})
+	}
+	sort.Sort(byCount(result))
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+type byCount []genreCount
+
+func (s byCount) Len() int      { return len(s) }
+func (s byCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool {
+	if s[i].count != s[j].count {
+		return s[i].count > s[j].count
+	}
+	return s[i].genre < s[j].genre
+}
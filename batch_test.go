@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingWiki responds to the page of Nevermind with HTTP 429 and leaves
+// searches for anything else hanging until they are given up.
+func blockingWiki() *fakeWiki {
+	wiki := newFakeWiki(
+		map[string][]string{"Nevermind (Nirvana album)": {"Nevermind"}},
+		map[string]string{"Nevermind": "hlist-infobox"},
+	)
+	wiki.setStatus("Nevermind", http.StatusTooManyRequests)
+	wiki.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("search"); q != "" && q != "Nevermind (Nirvana album)" {
+			<-r.Context().Done()
+			return
+		}
+		wiki.ServeHTTP(w, r)
+	})
+	return wiki
+}
+
+func TestBatchStopsOnFatalError(t *testing.T) {
+	wiki := blockingWiki()
+	defer wiki.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	queries := []string{"Nirvana - Nevermind", "Nirvana - Bleach", "Nirvana - In Utero"}
+	for _, r := range wiki.client().BatchAlbumGenresContext(ctx, queries) {
+		if _, ok := r.Err.(*BlockedError); !ok {
+			t.Errorf("%s: got error %v, want BlockedError", r.Query, r.Err)
+		}
+	}
+}
+
+func TestStreamStopsOnFatalError(t *testing.T) {
+	wiki := blockingWiki()
+	defer wiki.Close()
+	as := make(chan artistAlbum)
+	go func() {
+		defer close(as)
+		for _, q := range []string{"Nirvana - Nevermind", "Nirvana - Bleach", "Nirvana - In Utero"} {
+			as <- parsePlainItem(q)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for r := range wiki.client().streamAlbums(ctx, as, 3) {
+		if _, ok := r.Err.(*BlockedError); !ok {
+			t.Errorf("%s: got error %v, want BlockedError", r.Query, r.Err)
+		}
+	}
+}
+
+// nevermindWiki serves the Nevermind page found by its first search variant.
+func nevermindWiki() *fakeWiki {
+	return newFakeWiki(
+		map[string][]string{"Nevermind (Nirvana album)": {"Nevermind"}},
+		map[string]string{"Nevermind": "hlist-infobox"},
+	)
+}
+
+func TestBatchRepeatedQueryPrinted(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	results := wiki.client().BatchAlbumGenres([]string{"Nirvana - Nevermind", "Nirvana - Nevermind"})
+	var buf bytes.Buffer
+	p := textPrinter{&buf, true, "-"}
+	for _, r := range results {
+		p.Print(r)
+	}
+	const line = "Nirvana - Nevermind\tGrunge; Alternative Rock\n"
+	if got := buf.String(); got != line+line {
+		t.Errorf("got output\n%s\nwant\n%s", got, line+line)
+	}
+}
+
+func TestBatchRepeatedQueryResults(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	queries := []string{"Nirvana - Nevermind", "", "Nirvana - Nevermind", "Nirvana - Nevermind", "", "Nirvana - Nevermind"}
+	results := wiki.client().BatchAlbumGenres(queries)
+	want := []string{"Grunge", "Alternative Rock"}
+	first := true
+	for i, r := range results {
+		if queries[i] == "" {
+			continue
+		}
+		if r.Err != nil || !reflect.DeepEqual(r.Genres(), want) {
+			t.Errorf("query %d: got genres %q and error %v, want %q", i, r.Genres(), r.Err, want)
+		}
+		if r.Cached == first {
+			t.Errorf("query %d: got Cached %v, want %v", i, r.Cached, !first)
+		}
+		first = false
+	}
+	// One search and one page for all of them.
+	if n := wiki.requestCount(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestBatchGenresFromURL(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	nevermind := wiki.URL + "/wiki/Nevermind"
+	bleach := wiki.URL + "/wiki/Bleach"
+	var mu sync.Mutex
+	skipArgs := make(map[string]bool)
+	c := wiki.client(WithSkip(func(artist, album string) bool {
+		mu.Lock()
+		skipArgs[artist+"|"+album] = true
+		mu.Unlock()
+		return album == bleach
+	}))
+	results := c.BatchGenresFromURL([]string{nevermind, bleach, "", nevermind})
+	if want := []string{"Grunge", "Alternative Rock"}; !reflect.DeepEqual(results[0].Genres(), want) {
+		t.Errorf("got genres %q and error %v, want %q", results[0].Genres(), results[0].Err, want)
+	}
+	if !results[1].Skipped || results[1].Err != nil {
+		t.Errorf("%s: got %+v, want it skipped", bleach, results[1])
+	}
+	if results[2].Query != "" || results[2].Info != nil || results[2].Err != nil {
+		t.Errorf("empty URL: got %+v, want an empty result", results[2])
+	}
+	if !results[3].Cached || !reflect.DeepEqual(results[3].Genres(), results[0].Genres()) {
+		t.Errorf("repeated URL: got %+v, want cached genres of the first", results[3])
+	}
+	if want := map[string]bool{"|" + nevermind: true, "|" + bleach: true}; !reflect.DeepEqual(skipArgs, want) {
+		t.Errorf("skip called with %v, want %v", skipArgs, want)
+	}
+}
+
+func TestBatchGenresFromURLContext(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range wiki.client().BatchGenresFromURLContext(ctx, []string{wiki.URL + "/wiki/Nevermind"}) {
+		if r.Err != context.Canceled {
+			t.Errorf("%s: got error %v, want %v", r.Query, r.Err, context.Canceled)
+		}
+	}
+	if n := wiki.requestCount(); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
+
+func TestBatchAlbumGenresMapSkipped(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	c := wiki.client(WithSkip(func(artist, album string) bool {
+		return album == "Bleach"
+	}))
+	genres, errs := c.BatchAlbumGenresMap([]string{"Nirvana - Nevermind", "Nirvana - Bleach"})
+	want := map[string][]string{"Nirvana - Nevermind": {"Grunge", "Alternative Rock"}}
+	if !reflect.DeepEqual(genres, want) || len(errs) > 0 {
+		t.Errorf("got genres %q and errors %v, want %q", genres, errs, want)
+	}
+}
+
+func TestLookupAlbumsDoneSerialized(t *testing.T) {
+	wiki := newFakeWiki(
+		map[string][]string{
+			"Nevermind (Nirvana album)": {"Nevermind"},
+			"In Utero (Nirvana album)":  {"In Utero"},
+		},
+		map[string]string{"Nevermind": "hlist-infobox", "In Utero": "mobile"},
+	)
+	defer wiki.Close()
+	queries := []string{"Nirvana - Nevermind", "Nirvana - In Utero", "Nirvana - Bleach", "Nirvana - Nevermind"}
+	// done changes state without locking, which the race detector would
+	// catch if it was called concurrently.
+	var done []string
+	counts := make(map[string]int)
+	c := wiki.client()
+	results := c.lookupAlbumsFunc(context.Background(), artistAlbumsFromCLI(queries), c.searchLookup, func(r BatchResult) {
+		done = append(done, r.Query)
+		countGenres(counts, r)
+	})
+	if len(done) != 3 {
+		t.Errorf("done called for %q, want each unique query once", done)
+	}
+	want := map[string]int{"grunge": 2, "alternative rock": 2, "noise rock": 1}
+	if !reflect.DeepEqual(counts, want) || !reflect.DeepEqual(GenreCounts(results), want) {
+		t.Errorf("got genre counts %v, want %v", counts, want)
+	}
+}
+
+func TestStreamConcurrency(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	var inFlight, maxInFlight int32
+	wiki.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		wiki.ServeHTTP(w, r)
+	})
+	as := make(chan artistAlbum)
+	go func() {
+		defer close(as)
+		for i := 0; i < 8; i++ {
+			as <- parsePlainItem("Nirvana - Nevermind")
+		}
+	}()
+	for r := range wiki.client().streamAlbums(context.Background(), as, 2) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+	if maxInFlight > 2 {
+		t.Errorf("got %d requests in flight, want at most 2", maxInFlight)
+	}
+}
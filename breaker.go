@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of sending requests while the circuit
+// breaker set with WithCircuitBreaker is open.
+var ErrCircuitOpen = fmt.Errorf("too many failed requests to Wikipedia, backing off")
+
+// WithCircuitBreaker stops sending requests after failures consecutive ones
+// failed within window, with a network error, a server error or HTTP 429.
+// Requests fail with ErrCircuitOpen for cooldown, then a single request is let
+// through to test whether Wikipedia has recovered. If it succeeds, requests
+// are sent as usual again, otherwise the breaker opens for another cooldown.
+// Only requests to the client's Wikipedia count, requests to other services
+// are neither stopped nor held against it.
+func WithCircuitBreaker(failures int, window, cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.breaker = &breaker{
+			threshold: failures,
+			window:    window,
+			cooldown:  cooldown,
+		}
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	first    time.Time // of consecutive failures
+	openedAt time.Time
+}
+
+// allow tells whether a request may be sent now.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// The trial request is still in flight.
+		return false
+	}
+	return true
+}
+
+// report records outcome of a request allowed by the breaker.
+func (b *breaker) report(resp *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !isFailure(resp, err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	now := time.Now()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+		b.openedAt = now
+		return
+	}
+	if b.failures == 0 || now.Sub(b.first) > b.window {
+		b.failures = 0
+		b.first = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		b.failures = 0
+	}
+}
+
+// isFailure tells whether a request failed in a way suggesting that the
+// server is unavailable or overloaded.
+func isFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
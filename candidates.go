@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// AlbumResult is a page found by AlbumCandidates.
+type AlbumResult struct {
+	Info *AlbumInfo
+	// Query is the search query the page was found by, e.g. "Nevermind
+	// (Nirvana album)".
+	Query string
+}
+
+// AlbumCandidates finds up to k album pages with genres using DefaultClient.
+func AlbumCandidates(artist, album string, k int) ([]AlbumResult, error) {
+	return DefaultClient.AlbumCandidates(artist, album, k)
+}
+
+// AlbumCandidates finds up to k distinct pages with genres that may be the
+// album, so that the right one can be picked by hand rather than by
+// LookupAlbum. Up to k search results of each search variant are scraped
+// until k pages are found. Results are ranked by confidence, and pages found
+// by earlier variants and higher in search results come first among equals.
+// If no page has genres, the error is ErrNoGenres, or the last one of pages
+// that failed to load.
+func (c *Client) AlbumCandidates(artist, album string, k int) ([]AlbumResult, error) {
+	return c.albumCandidates(context.Background(), artist, album, k)
+}
+
+func (c *Client) albumCandidates(ctx context.Context, artist, album string, k int) ([]AlbumResult, error) {
+	if k < 1 {
+		k = 1
+	}
+	variants := c.searchVariants(artist, album, 0)
+	if c.maxVariants > 0 && len(variants) > c.maxVariants {
+		variants = variants[:c.maxVariants]
+	}
+
+	var result []AlbumResult
+	seen := make(map[string]bool)
+	var lastErr error
+	for _, variant := range variants {
+		sr, err := c.searchWikipedia(ctx, variant)
+		if isFatal(err) {
+			return nil, err
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		uris := sr.uris
+		if len(uris) > k {
+			uris = uris[:k]
+		}
+		for _, uri := range uris {
+			uri = c.articleURL(uri)
+			if seen[uri] {
+				continue
+			}
+			seen[uri] = true
+			info, err := c.pageInfo(ctx, uri)
+			if isFatal(err) {
+				return nil, err
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if len(info.Genres) == 0 || info.Confidence < c.minConfidence {
+				continue
+			}
+			if variant != artist && !c.titleMatches(info.Title, album) {
+				continue
+			}
+			result = append(result, AlbumResult{c.normalizeInfo(info), variant})
+			if len(result) == k {
+				break
+			}
+		}
+		if len(result) == k {
+			break
+		}
+	}
+	if len(result) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrNoGenres
+	}
+	sort.Stable(byConfidence(result))
+	return result, nil
+}
+
+type byConfidence []AlbumResult
+
+func (s byConfidence) Len() int           { return len(s) }
+func (s byConfidence) Less(i, j int) bool { return s[i].Info.Confidence > s[j].Info.Confidence }
+func (s byConfidence) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
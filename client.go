@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultUserAgent      = "Wikigenre"
+	defaultLanguage       = "en"
+	defaultBaseURL        = "https://en.wikipedia.org/w/api.php"
+	defaultArticleBaseURL = "https://en.wikipedia.org/wiki/"
+	defaultRetries        = 2
+	defaultRetryDelay     = 500 * time.Millisecond
+	defaultConnectTimeout = 10 * time.Second
+)
+
+// Client searches Wikipedia for albums and scrapes their genres. Create
+// clients with NewClient.
+type Client struct {
+	requests int64 // accessed atomically, kept first for 64-bit alignment
+
+	userAgent      string
+	headers        map[string]string
+	language       string
+	baseURL        string
+	articleBaseURL string
+	retries        int
+	retryDelay     time.Duration
+	retryBudget    *tokenBucket
+	jitter         *jitter
+	connectTimeout time.Duration
+	tlsConfig      *tls.Config
+
+	idleConnsPerHost int
+	maxConnsPerHost  int
+	transport        http.RoundTripper
+	httpClient       *http.Client
+
+	preservedTokens map[string]string
+	styles          bool
+	sortGenres      bool
+	genreCase       Case
+	umbrellaGenres  map[string]bool
+	titleCaser      unicode.SpecialCase
+	leadLexicon     []string
+	leadMatcher     *genreMatcher
+	shortDesc       bool
+	dbpedia         bool
+
+	fallbackLanguages []string
+	mergedLanguages   []string
+	metrics           Metrics
+	searchParams      url.Values
+	searchStrategy    SearchStrategy
+	scrapeStrategy    ScrapeStrategy
+	maxCandidates     int
+	maxVariants       int
+	preferTypes       []string
+	redirects         bool
+	genreIDs          bool
+	discographyTables bool
+	skip              func(artist, album string) bool
+	endpoints         *endpoints
+	breaker           *breaker
+	minConfidence     float64
+	minSimilarity     float64
+	artistFallback    bool
+	parallelVariants  bool
+	mergePages        int
+	genreLabels       []string
+	joinLinks         bool
+	selectors         Selectors
+	scrapeHAudio      bool
+	scrapeInfobox     bool
+	releaseClasses    []string
+	infoboxDump       bool
+
+	musicBrainzLimiter *rateLimiter
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// DefaultClient is used by package-level functions such as AlbumGenres.
+var DefaultClient = NewClient()
+
+// NewClient returns a client configured with the given options. Long-running
+// programs that create and discard clients should defer Close.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		userAgent:          defaultUserAgent,
+		language:           defaultLanguage,
+		baseURL:            defaultBaseURL,
+		articleBaseURL:     defaultArticleBaseURL,
+		retries:            defaultRetries,
+		retryDelay:         defaultRetryDelay,
+		jitter:             &jitter{rand: rand.New(rand.NewSource(time.Now().UnixNano()))},
+		searchStrategy:     SearchOpenSearch,
+		scrapeStrategy:     ScrapeHTML,
+		maxCandidates:      1,
+		artistFallback:     true,
+		genreLabels:        defaultGenreLabels,
+		selectors:          DefaultSelectors,
+		scrapeHAudio:       true,
+		scrapeInfobox:      true,
+		releaseClasses:     defaultReleaseClasses,
+		connectTimeout:     defaultConnectTimeout,
+		metrics:            nopMetrics{},
+		musicBrainzLimiter: &rateLimiter{interval: musicBrainzInterval},
+		preservedTokens:    make(map[string]string),
+		searchParams: url.Values{
+			"namespace": {"0"},
+			"redirects": {"resolve"},
+		},
+	}
+	WithPreservedTokens(defaultPreservedTokens...)(c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Transport: c.transport}
+		if c.transport == nil {
+			c.httpClient.Transport = c.newTransport()
+		}
+	}
+	return c
+}
+
+// Close releases resources held by the client, such as idle connections to
+// Wikipedia. The client may still be used afterwards, at the cost of opening
+// new connections. An HTTP client given with WithHTTPClient that has no
+// transport of its own shares http.DefaultTransport with the rest of the
+// program, so its connections are left alone.
+func (c *Client) Close() error {
+	type idleCloser interface {
+		CloseIdleConnections()
+	}
+	if t, ok := c.httpClient.Transport.(idleCloser); ok {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
+
+// newTransport returns the transport used unless an HTTP client is given
+// with WithHTTPClient.
+func (c *Client) newTransport() http.RoundTripper {
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                (&net.Dialer{Timeout: c.connectTimeout}).Dial,
+		TLSHandshakeTimeout: c.connectTimeout,
+		TLSClientConfig:     c.tlsConfig,
+		MaxIdleConnsPerHost: c.idleConnsPerHost,
+	}
+	if c.maxConnsPerHost <= 0 {
+		return t
+	}
+	if t.MaxIdleConnsPerHost <= 0 || t.MaxIdleConnsPerHost > c.maxConnsPerHost {
+		t.MaxIdleConnsPerHost = c.maxConnsPerHost
+	}
+	return &limitedTransport{base: t, max: c.maxConnsPerHost}
+}
+
+// WithHTTPClient makes the client send requests with hc. Transport options
+// such as WithConnectTimeout have no effect then.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTransport makes the client send all requests, search and page fetches
+// alike, through rt. This is the place to plug in a caching transport, e.g.
+// one from github.com/gregjones/httpcache. Transport options such as
+// WithConnectTimeout have no effect then.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithConnectTimeout limits time to establish a connection to Wikipedia.
+// Defaults to 10 seconds.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.connectTimeout = timeout
+	}
+}
+
+// WithTLSConfig sets TLS configuration used to connect to Wikipedia, e.g. to
+// trust the root CA of a TLS-inspecting proxy by adding it to RootCAs.
+// Setting InsecureSkipVerify disables certificate verification entirely,
+// which is possible but discouraged. Like WithConnectTimeout, it has no effect
+// with WithHTTPClient or WithTransport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithHeaders adds headers to both search and page requests. A User-Agent
+// given here is appended to the default one rather than replacing it. An
+// Accept-Language given here replaces the one derived from WithLanguage.
+func WithHeaders(headers map[string]string) Option {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = make(map[string]string)
+		}
+		for name, value := range headers {
+			c.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+}
+
+// WithLanguage makes the client search Wikipedia in the given language, e.g.
+// "de" for the German Wikipedia. It overrides WithBaseURL and
+// WithArticleBaseURL given before it.
+func WithLanguage(lang string) Option {
+	return func(c *Client) {
+		c.language = lang
+		c.baseURL, c.articleBaseURL = languageURLs(lang)
+	}
+}
+
+// languageURLs returns API and article base URLs of Wikipedia in lang.
+func languageURLs(lang string) (baseURL, articleBaseURL string) {
+	host := "https://" + lang + ".wikipedia.org"
+	return host + "/w/api.php", host + "/wiki/"
+}
+
+// WithBaseURL sets the URL of MediaWiki API used for search, e.g. of a
+// Wikipedia mirror. Defaults to the English Wikipedia API.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithArticleBaseURL sets the URL that article titles are appended to when
+// fetching pages. Defaults to "https://en.wikipedia.org/wiki/". Mobile pages,
+// e.g. of "https://en.m.wikipedia.org/wiki/", are smaller and have the same
+// infobox, but they don't list categories, so SourceCategories never applies
+// to them.
+func WithArticleBaseURL(articleBaseURL string) Option {
+	return func(c *Client) {
+		if !strings.HasSuffix(articleBaseURL, "/") {
+			articleBaseURL += "/"
+		}
+		c.articleBaseURL = articleBaseURL
+	}
+}
+
+// articleURL rewrites an article URI returned by search to point to the
+// client's article base URL.
+func (c *Client) articleURL(uri string) string {
+	i := strings.Index(uri, "/wiki/")
+	if i < 0 {
+		return uri
+	}
+	return c.articleBaseURL + uri[i+len("/wiki/"):]
+}
+
+// WithRetries sets how many times a page fetch is retried after a network
+// error, including a connection dropped while reading the body. The delay
+// before each next retry is doubled. Each delay is picked at random between
+// half and all of it, so that lookups failing at once don't retry in
+// lockstep. Defaults to 2 retries after 500ms.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryDelay = delay
+	}
+}
+
+// WithSearchParams sets extra parameters of opensearch requests, replacing
+// defaults with the same names. By default only articles are searched
+// ("namespace=0") and redirects are resolved by the API ("redirects=resolve").
+func WithSearchParams(params url.Values) Option {
+	return func(c *Client) {
+		for name, values := range params {
+			c.searchParams[name] = values
+		}
+	}
+}
+
+// WithCandidates sets how many search results of each variant are scraped
+// until a page with genres is found. Pages that fail to load are skipped as
+// long as another one loads. Defaults to 1, only the top result.
+func WithCandidates(n int) Option {
+	return func(c *Client) {
+		if n < 1 {
+			n = 1
+		}
+		c.maxCandidates = n
+	}
+}
+
+// WithMaxVariants limits how many search variants, such as "Album (Artist
+// album)" and "Album (album)", a lookup tries before giving up. Together with
+// WithCandidates it bounds the number of requests per album. Defaults to 0,
+// trying all variants.
+func WithMaxVariants(n int) Option {
+	return func(c *Client) {
+		c.maxVariants = n
+	}
+}
+
+// Release types preferred by WithPreferredTypes by default.
+var defaultPreferredTypes = []string{"Studio album", "Album", "EP", "Compilation", "Single"}
+
+// WithPreferredTypes makes lookups try all search variants and pick the page
+// whose release type, see AlbumInfo.Type, comes first in types, e.g. the
+// studio album rather than a singles compilation of the same name. Pages of
+// other types rank last, and earlier variants win ties. If types is empty,
+// studio albums are preferred over albums, EPs, compilations and singles.
+func WithPreferredTypes(types ...string) Option {
+	return func(c *Client) {
+		if len(types) == 0 {
+			types = defaultPreferredTypes
+		}
+		c.preferTypes = types
+	}
+}
+
+// WithStyles makes LookupAlbum also scrape the "Styles" infobox row into
+// AlbumInfo.Styles. Styles never end up in Genres.
+func WithStyles() Option {
+	return func(c *Client) {
+		c.styles = true
+	}
+}
+
+// WithLeadGenres enables a last-resort heuristic that looks for genres from
+// lexicon in the lead paragraph of the article. If lexicon is empty, a
+// built-in list of common genres is used. Genres found this way are marked
+// with SourceLead. The lexicon also tells which article categories, like
+// "Grunge albums", name a genre of the album, see SourceCategories.
+func WithLeadGenres(lexicon ...string) Option {
+	return func(c *Client) {
+		if len(lexicon) == 0 {
+			lexicon = defaultGenreLexicon
+		}
+		c.leadLexicon = lexicon
+		c.leadMatcher = newGenreMatcher(lexicon)
+	}
+}
+
+// WithShortDescription makes LookupAlbum read the short description of the
+// article, like "1991 studio album by Nirvana", into AlbumInfo.Description.
+// The description confirms that the page is about an album rather than a
+// genre, and genres found in it are used if the page has no better source.
+// Such genres are marked with SourceShortDesc and looked up in the lexicon of
+// WithLeadGenres, or a built-in list of common genres.
+func WithShortDescription() Option {
+	return func(c *Client) {
+		c.shortDesc = true
+	}
+}
+
+// genreLexicon returns genres looked for in short descriptions and names of
+// article categories.
+func (c *Client) genreLexicon() []string {
+	if c.leadLexicon != nil {
+		return c.leadLexicon
+	}
+	return defaultGenreLexicon
+}
+
+// genreMatcher returns the matcher of genres of genreLexicon.
+func (c *Client) genreMatcher() *genreMatcher {
+	if c.leadMatcher != nil {
+		return c.leadMatcher
+	}
+	defaultMatcherOnce.Do(func() {
+		defaultMatcher = newGenreMatcher(defaultGenreLexicon)
+	})
+	return defaultMatcher
+}
+
+var (
+	defaultMatcherOnce sync.Once
+	defaultMatcher     *genreMatcher
+)
+
+// Labels of the infobox row listing genres.
+var defaultGenreLabels = []string{"Genre", "Genres"}
+
+// WithGenreLabels sets labels of the infobox row listing genres, e.g.
+// "Gênero" for the Portuguese Wikipedia. Labels are matched ignoring case and
+// tried in the given order. Defaults to "Genre" and "Genres".
+func WithGenreLabels(labels ...string) Option {
+	return func(c *Client) {
+		c.genreLabels = labels
+	}
+}
+
+// WithJoinedLinks makes genre links directly adjacent to each other count as
+// a single genre with their combined text, e.g. "Jazz fusion" for separate
+// links to "Jazz" and "fusion". Links separated by commas, middots or list
+// items are still distinct genres.
+func WithJoinedLinks() Option {
+	return func(c *Client) {
+		c.joinLinks = true
+	}
+}
+
+// WithoutArtistFallback stops album lookups from searching for the artist
+// alone as the last resort, which yields genres of the artist rather than of
+// the album. Lookups by artist only are unaffected.
+func WithoutArtistFallback() Option {
+	return func(c *Client) {
+		c.artistFallback = false
+	}
+}
+
+// Maximum number of pages whose genres are merged.
+const maxMergePages = 5
+
+// WithMergedPages makes lookups merge genres of up to n distinct pages found
+// by search variants, e.g. of both the album and the artist, instead of
+// taking the first page with genres. It trades precision for recall.
+// Duplicate genres are dropped ignoring case, and other album info comes from
+// the first page. n is capped at 5.
+func WithMergedPages(n int) Option {
+	return func(c *Client) {
+		if n > maxMergePages {
+			n = maxMergePages
+		}
+		c.mergePages = n
+	}
+}
+
+// WithParallelVariants makes lookups try all search variants, such as
+// "Album (Artist album)" and "Album (album)", at once rather than one after
+// another. The earliest variant with genres still wins, and requests for the
+// rest are cancelled as soon as it's found. It cuts latency when the first
+// variants miss at the cost of a few extra requests.
+func WithParallelVariants() Option {
+	return func(c *Client) {
+		c.parallelVariants = true
+	}
+}
+
+// WithMinConfidence makes lookups skip pages whose genres have confidence
+// below min, see GenreSource.Confidence. If all pages are skipped, lookup
+// fails with ErrLowConfidence. Defaults to 0, accepting any genres.
+func WithMinConfidence(min float64) Option {
+	return func(c *Client) {
+		c.minConfidence = min
+	}
+}
+
+// queryAPI sends a request with params to MediaWiki API at apiURL and decodes
+// JSON response into v.
+func (c *Client) queryAPI(ctx context.Context, apiURL string, params url.Values, v interface{}) error {
+	params.Set("format", "json")
+	resp, err := c.get(ctx, apiURL, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !isResponseOK(resp) {
+		return statusError(apiURL, resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// get sends a GET request to uri with query params.
+func (c *Client) get(ctx context.Context, uri string, params url.Values) (*http.Response, error) {
+	req, err := c.request(ctx, uri, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// do sends a request prepared by the client. Only requests to the client's
+// own Wikipedia are subject to the circuit breaker and endpoint failover,
+// requests to DBpedia, MusicBrainz or Wikipedias in other languages are sent
+// as is and their outcome isn't held against Wikipedia.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	wiki := c.isWikipedia(req.URL)
+	breaker := c.breaker != nil && wiki
+	if breaker && !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	atomic.AddInt64(&c.requests, 1)
+	c.metrics.Increment("requests")
+	routed := c.endpoints != nil && wiki
+	var endpoint int
+	if routed {
+		endpoint = c.endpoints.route(req)
+	}
+	resp, err := c.httpClient.Do(req)
+	if routed {
+		c.endpoints.report(endpoint, resp, err)
+	}
+	if breaker {
+		c.breaker.report(resp, err)
+	}
+	if err != nil {
+		c.metrics.Increment("errors.network")
+	} else if !isResponseOK(resp) {
+		c.metrics.Increment("errors.http")
+	}
+	return resp, err
+}
+
+// isWikipedia tells whether u points to the host of the client's API or
+// articles.
+func (c *Client) isWikipedia(u *url.URL) bool {
+	for _, base := range []string{c.baseURL, c.articleBaseURL} {
+		if b, err := url.Parse(base); err == nil && b.Host == u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCount returns the number of HTTP requests sent by the client.
+func (c *Client) requestCount() int64 {
+	return atomic.LoadInt64(&c.requests)
+}
+
+// WithRedirects makes LookupAlbum fetch titles that redirect to the album
+// article into AlbumInfo.Redirects. It costs an extra request per album.
+func WithRedirects() Option {
+	return func(c *Client) {
+		c.redirects = true
+	}
+}
+
+// redirectTitles returns titles of pages that redirect to the article.
+func (c *Client) redirectTitles(ctx context.Context, title string) ([]string, error) {
+	var rr struct {
+		Query struct {
+			Pages map[string]struct {
+				Redirects []struct {
+					Title string
+				}
+			}
+		}
+	}
+	err := c.queryAPI(ctx, c.baseURL, url.Values{
+		"action":  {"query"},
+		"prop":    {"redirects"},
+		"titles":  {title},
+		"rdlimit": {"max"},
+	}, &rr)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, page := range rr.Query.Pages {
+		for _, r := range page.Redirects {
+			result = append(result, r.Title)
+		}
+	}
+	return result, nil
+}
+
+// request prepares a GET request to uri with query params carrying the
+// client's headers. Accept-Language is the client's language unless given
+// with WithHeaders.
+func (c *Client) request(ctx context.Context, uri string, params url.Values) (*http.Request, error) {
+	if len(params) > 0 {
+		uri += "?" + params.Encode()
+	}
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept-Language", c.language)
+	userAgent := c.userAgent
+	for name, value := range c.headers {
+		if name == "User-Agent" {
+			userAgent += " " + value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is a transport that responds without any network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubResponse returns a bare response with status and an empty body.
+func stubResponse(status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+}
+
+// cachingTransport is a minimal caching transport that serves responses to
+// repeated GET requests from memory.
+type cachingTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	responses map[string][]byte
+	hits      int
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	t.mu.Lock()
+	dump, ok := t.responses[key]
+	if ok {
+		t.hits++
+	}
+	t.mu.Unlock()
+	if ok {
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	dump, err = httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.responses[key] = dump
+	t.mu.Unlock()
+	return resp, nil
+}
+
+func TestWithTransportCaching(t *testing.T) {
+	wiki := newFakeWiki(
+		map[string][]string{"Nevermind (Nirvana album)": {"Nevermind"}},
+		map[string]string{"Nevermind": "hlist-infobox"},
+	)
+	defer wiki.Close()
+	cache := &cachingTransport{base: &http.Transport{}, responses: make(map[string][]byte)}
+	c := wiki.client(WithTransport(cache))
+
+	for i := 0; i < 2; i++ {
+		genres, err := c.AlbumGenres("Nirvana", "Nevermind")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"Grunge", "Alternative Rock"}; !reflect.DeepEqual(genres, want) {
+			t.Errorf("lookup %d: got genres %q, want %q", i+1, genres, want)
+		}
+	}
+	// The search and the page request of the first lookup hit the server,
+	// the second lookup is served from the cache.
+	if n := wiki.requestCount(); n != 2 {
+		t.Errorf("got %d requests to the server, want 2", n)
+	}
+	if cache.hits != 2 {
+		t.Errorf("got %d cache hits, want 2", cache.hits)
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		want string
+	}{
+		{nil, "en"},
+		{[]Option{WithLanguage("de")}, "de"},
+		{[]Option{WithLanguage("de"), WithHeaders(map[string]string{"accept-language": "de-AT, de;q=0.9"})}, "de-AT, de;q=0.9"},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		var got []string
+		wiki := newFakeWiki(
+			map[string][]string{"Nevermind": {"Nevermind"}},
+			map[string]string{"Nevermind": "hlist-infobox"},
+		)
+		wiki.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			got = append(got, r.Header.Get("Accept-Language"))
+			mu.Unlock()
+			wiki.ServeHTTP(w, r)
+		})
+		opts := append(tt.opts, WithBaseURL(wiki.URL+"/w/api.php"), WithArticleBaseURL(wiki.URL+"/wiki/"))
+		if _, err := NewClient(opts...).AlbumGenres("", "Nevermind"); err != nil {
+			t.Fatal(err)
+		}
+		wiki.Close()
+		// Two searches and a page request.
+		if want := []string{tt.want, tt.want, tt.want}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got Accept-Language %q, want %q", got, want)
+		}
+	}
+}
+
+// failingDBpedia responds with HTTP 500 to requests to DBpedia and records
+// hosts of requests to Wikipedia, which succeed.
+func failingDBpedia(hosts *[]string) http.RoundTripper {
+	var mu sync.Mutex
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "dbpedia.org" {
+			return stubResponse(http.StatusInternalServerError), nil
+		}
+		mu.Lock()
+		*hosts = append(*hosts, req.URL.Host)
+		mu.Unlock()
+		return stubResponse(http.StatusOK), nil
+	})
+}
+
+func TestCircuitBreakerIgnoresOtherHosts(t *testing.T) {
+	var hosts []string
+	c := NewClient(
+		WithTransport(failingDBpedia(&hosts)),
+		WithCircuitBreaker(2, time.Minute, time.Minute),
+	)
+	for i := 0; i < 3; i++ {
+		resp, err := c.get(context.Background(), "https://dbpedia.org/sparql", nil)
+		if err != nil {
+			t.Fatalf("DBpedia request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := c.get(context.Background(), c.baseURL, nil)
+	if err != nil {
+		t.Fatalf("got error %v after DBpedia failures, want none", err)
+	}
+	resp.Body.Close()
+}
+
+func TestEndpointsIgnoreOtherHosts(t *testing.T) {
+	var hosts []string
+	c := NewClient(
+		WithTransport(failingDBpedia(&hosts)),
+		WithEndpoints([]string{"https://primary.example", "https://mirror.example"}),
+	)
+	for i := 0; i < failoverThreshold; i++ {
+		resp, err := c.get(context.Background(), "https://dbpedia.org/sparql", nil)
+		if err != nil {
+			t.Fatalf("DBpedia request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := c.get(context.Background(), c.baseURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want := []string{"primary.example"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got requests to %q, want %q", hosts, want)
+	}
+}
+
+func TestBareErrorResponse(t *testing.T) {
+	c := NewClient(WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return stubResponse(http.StatusInternalServerError), nil
+	})))
+	uri := c.articleBaseURL + "Nevermind"
+	_, err := c.GenresFromURL(uri)
+	e, ok := err.(*HTTPError)
+	if !ok || e.StatusCode != http.StatusInternalServerError || e.URL != uri {
+		t.Errorf("got error %#v, want HTTP 500 error for %s", err, uri)
+	}
+}
+
+func TestWithMaxConnsPerHost(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+	c := NewClient(WithMaxConnsPerHost(2))
+	defer c.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.get(context.Background(), srv.URL, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > 2 {
+		t.Errorf("got %d requests in flight, want at most 2", maxInFlight)
+	}
+}
+
+func TestWithMaxConnsPerHostCancel(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-unblock
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(WithMaxConnsPerHost(1))
+	defer c.Close()
+
+	slow := make(chan error)
+	go func() {
+		resp, err := c.get(context.Background(), srv.URL+"/slow", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		slow <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The only slot is taken, so the request waits until it's given up.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.get(ctx, srv.URL, nil); !isURLError(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Closing the body of the slow response frees the slot.
+	close(unblock)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.get(ctx, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+// isURLError tells whether err is a *url.Error wrapping target.
+func isURLError(err, target error) bool {
+	e, ok := err.(*url.Error)
+	return ok && e.Err == target
+}
+
+// idleClosingTransport counts calls to CloseIdleConnections.
+type idleClosingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleClosingTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestClose(t *testing.T) {
+	rt := &idleClosingTransport{RoundTripper: http.DefaultTransport}
+	NewClient(WithTransport(rt)).Close()
+	if rt.closed != 1 {
+		t.Errorf("got %d calls to CloseIdleConnections, want 1", rt.closed)
+	}
+	// Must not reach for http.DefaultTransport.
+	NewClient(WithHTTPClient(&http.Client{})).Close()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WithFallbackLanguages makes LookupAlbum try the same article in Wikipedias
+// of other languages, in the given order, if the article found in the
+// client's language has no genres. Articles are matched using interlanguage
+// links, and genres are translated back where the genre articles are linked
+// too. Fallback only works with Wikipedia itself, not mirrors.
+func WithFallbackLanguages(langs ...string) Option {
+	return func(c *Client) {
+		c.fallbackLanguages = langs
+	}
+}
+
+// crossWikiInfo scrapes the first article in fallback languages which is
+// linked from primary and has genres. It returns nil if there's none.
+func (c *Client) crossWikiInfo(ctx context.Context, primary *AlbumInfo) (*AlbumInfo, error) {
+	title := articleTitle(primary.URL)
+	if title == "" {
+		return nil, nil
+	}
+	for _, lang := range c.fallbackLanguages {
+		if lang == c.language {
+			continue
+		}
+		info, err := c.foreignInfo(ctx, title, lang)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+	return nil, nil
+}
+
+// WithMergedLanguages makes LookupAlbum scrape the article found in the
+// client's language in Wikipedias of other languages as well, all at once,
+// and merge their genres into the ones found. Articles are matched and
+// genres translated back like with WithFallbackLanguages. AlbumInfo.Languages
+// lists the languages that contributed genres. It costs three extra requests
+// per language for every album, and languages whose article fails to load
+// are skipped.
+func WithMergedLanguages(langs ...string) Option {
+	return func(c *Client) {
+		c.mergedLanguages = langs
+	}
+}
+
+// mergeLanguages merges genres of the same article in the client's merged
+// languages into info.
+func (c *Client) mergeLanguages(ctx context.Context, info *AlbumInfo) {
+	title := articleTitle(info.URL)
+	if title == "" {
+		return
+	}
+	foreign := make([]*AlbumInfo, len(c.mergedLanguages))
+	var wg sync.WaitGroup
+	for i, lang := range c.mergedLanguages {
+		if lang == c.language {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, lang string) {
+			defer wg.Done()
+			foreign[i], _ = c.foreignInfo(ctx, title, lang)
+		}(i, lang)
+	}
+	wg.Wait()
+
+	if len(info.Genres) > 0 {
+		info.Languages = append(info.Languages, c.language)
+	}
+	for _, f := range foreign {
+		if f == nil {
+			continue
+		}
+		if len(info.Genres) == 0 {
+			info.Source = f.Source
+			info.Confidence = f.Confidence
+		}
+		info.Genres = append(info.Genres, f.Genres...)
+		info.Untranslated = append(info.Untranslated, f.Untranslated...)
+		info.Languages = append(info.Languages, f.Language)
+	}
+}
+
+// foreignInfo scrapes the article in lang linked from the article title in
+// the client's language, with genres translated back where possible. It
+// returns nil if there's no such article or it has no genres.
+func (c *Client) foreignInfo(ctx context.Context, title, lang string) (*AlbumInfo, error) {
+	links, err := c.langlinks(ctx, c.baseURL, []string{title}, lang)
+	if err != nil {
+		return nil, err
+	}
+	foreignTitle, ok := links[title]
+	if !ok {
+		return nil, nil
+	}
+
+	baseURL, articleBaseURL := languageURLs(lang)
+	uri := articleBaseURL + escapeTitle(foreignTitle)
+	doc, err := c.fetchDocument(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	info := c.scrapeAlbumInfo(doc)
+	if len(info.Genres) == 0 {
+		return nil, nil
+	}
+	info.URL = uri
+	info.Language = lang
+
+	translated, err := c.langlinks(ctx, baseURL, info.Genres, c.language)
+	if err != nil {
+		return nil, err
+	}
+	for i, g := range info.Genres {
+		if t, ok := translated[g]; ok {
+			info.Genres[i] = t
+		} else {
+			info.Untranslated = append(info.Untranslated, g)
+		}
+	}
+	return info, nil
+}
+
+type langlinksResponse struct {
+	Query struct {
+		Normalized []titleMapping
+		Redirects  []titleMapping
+		Pages      map[string]struct {
+			Title     string
+			Langlinks []struct {
+				Lang  string
+				Title string `json:"*"`
+			}
+		}
+	}
+}
+
+type titleMapping struct {
+	From, To string
+}
+
+// resolveTitle returns the title of the page that API responses list for
+// title, after normalization, e.g. "grunge" to "Grunge", and then redirects.
+func resolveTitle(title string, normalized, redirects []titleMapping) string {
+	for _, mappings := range [][]titleMapping{normalized, redirects} {
+		for _, m := range mappings {
+			if m.From == title {
+				title = m.To
+			}
+		}
+	}
+	return title
+}
+
+// langlinks maps titles of articles on the wiki at apiURL to titles of the
+// same articles in lang. Titles that have no such article are left out.
+func (c *Client) langlinks(ctx context.Context, apiURL string, titles []string, lang string) (map[string]string, error) {
+	var lr langlinksResponse
+	err := c.queryAPI(ctx, apiURL, url.Values{
+		"action":    {"query"},
+		"prop":      {"langlinks"},
+		"titles":    {strings.Join(titles, "|")},
+		"lllang":    {lang},
+		"redirects": {"1"},
+	}, &lr)
+	if err != nil {
+		return nil, err
+	}
+
+	linked := make(map[string]string)
+	for _, page := range lr.Query.Pages {
+		for _, ll := range page.Langlinks {
+			linked[page.Title] = ll.Title
+		}
+	}
+	result := make(map[string]string)
+	for _, title := range titles {
+		if t, ok := linked[resolveTitle(title, lr.Query.Normalized, lr.Query.Redirects)]; ok {
+			result[title] = t
+		}
+	}
+	return result, nil
+}
+
+// articleTitle extracts article title from its URL.
+func articleTitle(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	i := strings.Index(u.Path, "/wiki/")
+	if i < 0 {
+		return ""
+	}
+	return strings.Replace(u.Path[i+len("/wiki/"):], "_", " ", -1)
+}
+
+// escapeTitle turns article title into a URL path segment.
+func escapeTitle(title string) string {
+	u := url.URL{Path: strings.Replace(title, " ", "_", -1)}
+	return u.EscapedPath()
+}
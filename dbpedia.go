@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const (
+	dbpediaDataURL     = "https://dbpedia.org/data/"
+	dbpediaResourceURL = "http://dbpedia.org/resource/"
+	dbpediaGenre       = "http://dbpedia.org/ontology/genre"
+)
+
+// WithDBpedia makes lookups query DBpedia for genres of the album when the
+// page has no genres or only ones less trustworthy than SourceDBpedia. DBpedia
+// extracts genres from infoboxes with its own parser, which sometimes copes
+// with markup the scraper doesn't. It costs an extra request for such albums.
+// Only the English DBpedia is queried, so it's only useful with the English
+// Wikipedia.
+func WithDBpedia() Option {
+	return func(c *Client) {
+		c.dbpedia = true
+	}
+}
+
+// dbpediaGenres returns genres of the DBpedia resource about article title.
+func (c *Client) dbpediaGenres(ctx context.Context, title string) ([]string, error) {
+	uri := dbpediaDataURL + escapeTitle(title) + ".json"
+	resp, err := c.get(ctx, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !isResponseOK(resp) {
+		return nil, statusError(uri, resp)
+	}
+	// Resource IRI -> property IRI -> values.
+	var resources map[string]map[string][]struct {
+		Type  string
+		Value string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&resources); err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for iri, properties := range resources {
+		if resourceName(iri) != title {
+			continue
+		}
+		for _, value := range properties[dbpediaGenre] {
+			if value.Type != "uri" {
+				continue
+			}
+			if name := resourceName(value.Value); name != "" {
+				result = append(result, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// resourceName returns the title of the article DBpedia resource iri is
+// about, or an empty string if iri is not a resource.
+func resourceName(iri string) string {
+	u, err := url.Parse(iri)
+	if err != nil || !strings.HasPrefix(iri, dbpediaResourceURL) {
+		return ""
+	}
+	return strings.Replace(strings.TrimPrefix(u.Path, "/resource/"), "_", " ", -1)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
+)
+
+// ArtistDiscographyGenres looks up genres of albums by artist using
+// DefaultClient.
+func ArtistDiscographyGenres(artist string, albums []string) (map[string][]string, []error) {
+	return DefaultClient.ArtistDiscographyGenres(artist, albums)
+}
+
+// ArtistDiscographyGenres looks up genres of many albums by the same artist.
+// Instead of searching for each album, it first finds links to the albums on
+// the artist page and scrapes the linked pages. Albums that aren't linked, or
+// whose linked pages have no genres, are searched for as usual.
+//
+// The result maps album titles as given to their genres. Albums without genres
+// are left out of the map, and the errors explain why.
+func (c *Client) ArtistDiscographyGenres(artist string, albums []string) (map[string][]string, []error) {
+	links, err := c.artistAlbumLinks(artist)
+	if err != nil {
+		// Searching for each album may still work.
+		links = nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		result = make(map[string][]string)
+		errs   []error
+	)
+	for _, album := range albums {
+		wg.Add(1)
+		go func(album string) {
+			defer wg.Done()
+			genres, err := c.discographyAlbumGenres(artist, album, links[strings.ToLower(album)])
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error finding genres for %s - %s: %s", artist, album, err))
+				return
+			}
+			result[album] = genres
+		}(album)
+	}
+	wg.Wait()
+	return result, errs
+}
+
+// discographyAlbumGenres scrapes album page at uri, falling back to search if
+// uri is empty or the page has no genres.
+func (c *Client) discographyAlbumGenres(artist, album, uri string) ([]string, error) {
+	if uri != "" {
+		info, err := c.pageInfo(context.Background(), uri)
+		if err == nil && len(info.Genres) > 0 && info.Confidence >= c.minConfidence {
+			return c.normalizeInfo(info).Genres, nil
+		}
+	}
+	return c.AlbumGenres(artist, album)
+}
+
+// artistAlbumLinks finds the artist page and returns URLs of articles it links
+// to, keyed by lowercased link text.
+func (c *Client) artistAlbumLinks(artist string) (map[string]string, error) {
+	sr, err := c.searchWikipedia(context.Background(), artist)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.uris) == 0 {
+		return nil, nil
+	}
+	doc, err := c.fetchDocument(context.Background(), c.articleURL(sr.uris[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]string)
+	doc.Find(`#mw-content-text a[href^="/wiki/"]`).
+		Not(".new").
+		Each(func(i int, link *goquery.Selection) {
+			href, _ := link.Attr("href")
+			text := strings.ToLower(strings.TrimSpace(link.Text()))
+			if _, ok := links[text]; ok || strings.Contains(href, ":") {
+				return
+			}
+			links[text] = c.articleURL(href)
+		})
+	return links, nil
+}
+
+// WithDiscographyTables makes lookups that find no genres for an album look
+// for it in tables of the artist's discography page, e.g. "Nirvana
+// discography", and take genres from the row of the album if the table has a
+// genre column. This recovers genres of albums without articles of their own.
+// Such genres are marked with SourceDiscography. It costs two extra requests
+// for such albums.
+func WithDiscographyTables() Option {
+	return func(c *Client) {
+		c.discographyTables = true
+	}
+}
+
+// discographyInfo looks for album in tables of the discography page of
+// artist. It returns nil if there's no row of the album with genres.
+func (c *Client) discographyInfo(ctx context.Context, artist, album string) (*AlbumInfo, error) {
+	sr, err := c.searchWikipedia(ctx, artist+" discography")
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.uris) == 0 {
+		return nil, nil
+	}
+	uri := c.articleURL(sr.uris[0])
+	doc, err := c.fetchDocument(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	genres := c.discographyRowGenres(doc, album)
+	if len(genres) == 0 {
+		return nil, nil
+	}
+	return &AlbumInfo{
+		Title:      album,
+		URL:        uri,
+		Genres:     genres,
+		Source:     SourceDiscography,
+		Confidence: SourceDiscography.Confidence(),
+	}, nil
+}
+
+// discographyRowGenres returns genres from the genre column of the first
+// table row with a cell titled album. Cells spanning multiple rows are only
+// accounted for in the row they start in.
+func (c *Client) discographyRowGenres(doc *goquery.Document, album string) []string {
+	want := normalizeTitle(album)
+	if want == "" {
+		return nil
+	}
+	var result []string
+	doc.Find("table.wikitable").
+		EachWithBreak(func(i int, table *goquery.Selection) bool {
+			column := -1
+			table.Find("tr").
+				EachWithBreak(func(j int, row *goquery.Selection) bool {
+					cells := rowCells(row)
+					if column < 0 {
+						for k, cell := range cells {
+							if c.isGenreLabel(strings.TrimSpace(cell.Text())) {
+								column = k
+								break
+							}
+						}
+						return true
+					}
+					if column >= len(cells) {
+						return true
+					}
+					for _, cell := range cells {
+						if normalizeTitle(cell.Find("i").First().Text()) == want ||
+							normalizeTitle(cell.Text()) == want {
+							result = cellValues(cells[column])
+							return false
+						}
+					}
+					return true
+				})
+			return len(result) == 0
+		})
+	return result
+}
+
+// rowCells returns cells of table row with each cell repeated as many times
+// as the columns it spans.
+func rowCells(row *goquery.Selection) []*goquery.Selection {
+	var result []*goquery.Selection
+	row.Children().
+		Filter("th, td").
+		Each(func(i int, cell *goquery.Selection) {
+			span := 1
+			if colspan, ok := cell.Attr("colspan"); ok {
+				if n, err := strconv.Atoi(colspan); err == nil && n > 1 {
+					span = n
+				}
+			}
+			for ; span > 0; span-- {
+				result = append(result, cell)
+			}
+		})
+	return result
+}
+
+// isGenreLabel tells whether label is one of the client's genre labels.
+func (c *Client) isGenreLabel(label string) bool {
+	for _, l := range c.genreLabels {
+		if strings.EqualFold(label, l) {
+			return true
+		}
+	}
+	return false
+}
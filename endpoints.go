@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Failures in a row after which the client switches to the next endpoint.
+	failoverThreshold = 3
+	// Time after which the client gives the primary endpoint another chance.
+	failbackDelay = time.Minute
+)
+
+// WithEndpoints sets root URLs of Wikipedia and its mirrors, e.g.
+// "https://en.wikipedia.org". The first endpoint is the primary one and is
+// used exclusively while it's healthy. After it responds with 5xx or 429
+// statuses several times in a row, requests go to the next endpoint, and so
+// on. The primary endpoint is tried again a minute later. Mirrors must have
+// the same layout as Wikipedia, i.e. API at /w/api.php and articles at /wiki/.
+// Failures of requests to other hosts, e.g. DBpedia, don't count.
+func WithEndpoints(roots []string) Option {
+	return func(c *Client) {
+		if len(roots) == 0 {
+			return
+		}
+		ep := &endpoints{failures: make([]int, len(roots))}
+		for _, root := range roots {
+			ep.roots = append(ep.roots, strings.TrimSuffix(root, "/"))
+		}
+		c.endpoints = ep
+		c.baseURL = ep.roots[0] + "/w/api.php"
+		c.articleBaseURL = ep.roots[0] + "/wiki/"
+	}
+}
+
+// endpoints keeps track of endpoint health.
+type endpoints struct {
+	mu         sync.Mutex
+	roots      []string
+	failures   []int
+	current    int
+	switchedAt time.Time
+}
+
+// route points req to the current endpoint and returns its index.
+func (ep *endpoints) route(req *http.Request) int {
+	ep.mu.Lock()
+	if ep.current != 0 && time.Since(ep.switchedAt) > failbackDelay {
+		ep.current = 0
+		ep.failures[0] = 0
+	}
+	current := ep.current
+	ep.mu.Unlock()
+
+	primary, err := url.Parse(ep.roots[0])
+	if err != nil || req.URL.Host != primary.Host || current == 0 {
+		return current
+	}
+	target, err := url.Parse(ep.roots[current])
+	if err != nil {
+		return current
+	}
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = target.Path + strings.TrimPrefix(req.URL.Path, primary.Path)
+	req.Host = ""
+	return current
+}
+
+// report records outcome of a request sent to endpoint i.
+func (ep *endpoints) report(i int, resp *http.Response, err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if !isFailure(resp, err) {
+		ep.failures[i] = 0
+		return
+	}
+	ep.failures[i]++
+	if i == ep.current && ep.failures[i] >= failoverThreshold && len(ep.roots) > 1 {
+		ep.current = (ep.current + 1) % len(ep.roots)
+		ep.failures[ep.current] = 0
+		ep.switchedAt = time.Now()
+	}
+}
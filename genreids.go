@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
+)
+
+// GenreLink identifies the article a genre links to, which is more stable than
+// the genre's label, e.g. to tell genres apart across languages.
+type GenreLink struct {
+	Genre  string // as in AlbumInfo.Genres
+	Title  string // of the genre article, redirects resolved
+	PageID int
+	QID    string // Wikidata item ID, e.g. "Q11366", empty if there's none
+}
+
+// WithGenreIDs makes LookupAlbum resolve page IDs and Wikidata item IDs of
+// articles linked from genres into AlbumInfo.GenreLinks. Genres that aren't
+// links, such as ones found in categories, are left out. It costs an extra
+// request per album for every 50 genres.
+func WithGenreIDs() Option {
+	return func(c *Client) {
+		c.genreIDs = true
+	}
+}
+
+// Maximum number of titles per query of MediaWiki API.
+const maxQueryTitles = 50
+
+// linkTargets maps texts of links in the infobox and release infobox to titles
+// of articles they link to. Links to missing articles are left out.
+func (c *Client) linkTargets(doc *goquery.Document) map[string]string {
+	result := make(map[string]string)
+	c.mainInfobox(doc).
+		AddSelection(doc.Find(c.releaseSelector())).
+		Find("a[href]").
+		Not(".new").
+		Each(func(i int, link *goquery.Selection) {
+			href, _ := link.Attr("href")
+			text := strings.TrimSpace(link.Text())
+			if title := articleTitle(href); title != "" && !strings.Contains(title, ":") {
+				result[text] = title
+			}
+		})
+	return result
+}
+
+// genreLinks resolves articles linked from genres of info.
+func (c *Client) genreLinks(ctx context.Context, info *AlbumInfo) ([]GenreLink, error) {
+	var genres, titles []string
+	for _, g := range info.Genres {
+		if title, ok := info.linkTargets[g]; ok {
+			genres = append(genres, g)
+			titles = append(titles, title)
+		}
+	}
+
+	result := []GenreLink{}
+	for start := 0; start < len(titles); start += maxQueryTitles {
+		end := start + maxQueryTitles
+		if end > len(titles) {
+			end = len(titles)
+		}
+		pages, err := c.pageIDs(ctx, titles[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for i := start; i < end; i++ {
+			if link, ok := pages[titles[i]]; ok {
+				link.Genre = genres[i]
+				result = append(result, link)
+			}
+		}
+	}
+	return result, nil
+}
+
+type pagepropsResponse struct {
+	Query struct {
+		Normalized []titleMapping
+		Redirects  []titleMapping
+		Pages      map[string]struct {
+			PageID    int
+			Title     string
+			Missing   *string
+			PageProps struct {
+				WikibaseItem string `json:"wikibase_item"`
+			}
+		}
+	}
+}
+
+// pageIDs maps titles to IDs of their articles. Titles of missing articles
+// are left out.
+func (c *Client) pageIDs(ctx context.Context, titles []string) (map[string]GenreLink, error) {
+	var pr pagepropsResponse
+	err := c.queryAPI(ctx, c.baseURL, url.Values{
+		"action":    {"query"},
+		"prop":      {"pageprops"},
+		"ppprop":    {"wikibase_item"},
+		"titles":    {strings.Join(titles, "|")},
+		"redirects": {"1"},
+	}, &pr)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]GenreLink)
+	for _, page := range pr.Query.Pages {
+		if page.Missing != nil || page.PageID == 0 {
+			continue
+		}
+		found[page.Title] = GenreLink{Title: page.Title, PageID: page.PageID, QID: page.PageProps.WikibaseItem}
+	}
+	result := make(map[string]GenreLink)
+	for _, title := range titles {
+		if link, ok := found[resolveTitle(title, pr.Query.Normalized, pr.Query.Redirects)]; ok {
+			result[title] = link
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/ttacon/chalk"
+)
+
+// errorLogger reports errors of the command-line tool. Query is the album
+// being looked up when the error occurred, if any. Resolved reports the
+// article URL an album was resolved to, see -show-urls. Warning reports a
+// likely wrong match, see -warn.
+type errorLogger interface {
+	Error(query string, err error)
+	Resolved(query, url string)
+	Warning(query, msg string)
+}
+
+var errLogger errorLogger = colorErrorLogger{}
+
+// colorErrorLogger prints errors to stderr in red. It may be used
+// concurrently, each message is written at once.
+type colorErrorLogger struct{}
+
+func (colorErrorLogger) Error(query string, err error) {
+	if query == "" {
+		errorln(err)
+		return
+	}
+	errorln(fmt.Sprintf("error finding genres for %s: %s", query, err))
+}
+
+func (colorErrorLogger) Resolved(query, url string) {
+	colorln(chalk.Cyan, fmt.Sprintf("%s -> %s", query, url))
+}
+
+func (colorErrorLogger) Warning(query, msg string) {
+	colorln(chalk.Yellow, fmt.Sprintf("warning for %s: %s", query, msg))
+}
+
+func errorln(arg ...interface{}) {
+	colorln(chalk.Red, fmt.Sprint(arg...))
+}
+
+// colorMu serializes colored messages so that their color codes and text
+// don't interleave.
+var colorMu sync.Mutex
+
+// colorln prints msg to stderr in color, followed by a newline.
+func colorln(color chalk.Color, msg string) {
+	colorMu.Lock()
+	defer colorMu.Unlock()
+	fmt.Fprintf(colorStderr, "%s%s%s\n", color, msg, chalk.Reset)
+}
+
+// jsonErrorLogger writes errors as JSON objects, one per line, e.g.
+//
+//	{"level":"error","query":"Nirvana - Nevermind","error":"..."}
+//	{"level":"info","query":"Nirvana - Nevermind","url":"https://..."}
+//	{"level":"warning","query":"Nirvana - Nevermind","warning":"..."}
+//
+// It may be used concurrently.
+type jsonErrorLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonLogEntry struct {
+	Level   string `json:"level"`
+	Query   string `json:"query,omitempty"`
+	Error   string `json:"error,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Warning string `json:"warning,omitempty"`
+}
+
+func newJSONErrorLogger(w io.Writer) *jsonErrorLogger {
+	return &jsonErrorLogger{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonErrorLogger) Error(query string, err error) {
+	l.encode(jsonLogEntry{Level: "error", Query: query, Error: err.Error()})
+}
+
+func (l *jsonErrorLogger) Resolved(query, url string) {
+	l.encode(jsonLogEntry{Level: "info", Query: query, URL: url})
+}
+
+func (l *jsonErrorLogger) Warning(query, msg string) {
+	l.encode(jsonLogEntry{Level: "warning", Query: query, Warning: msg})
+}
+
+func (l *jsonErrorLogger) encode(e jsonLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// mappingEntry is how a query was resolved, as stored in files written by
+// -mapping-out and read by -mapping-in. Query is only set in checkpoints.
+type mappingEntry struct {
+	Query  string   `json:"query,omitempty"`
+	Title  string   `json:"title"`
+	URL    string   `json:"url"`
+	Genres []string `json:"genres"`
+}
+
+// readMapping reads resolved queries from the JSON file at path.
+func readMapping(path string) (map[string]mappingEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]mappingEntry
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// writeMapping writes successfully resolved queries of results to the JSON
+// file at path.
+func writeMapping(path string, results []BatchResult) error {
+	mapping := make(map[string]mappingEntry)
+	for _, r := range results {
+		if r.Info == nil {
+			continue
+		}
+		mapping[r.Query] = mappingEntry{"", r.Info.Title, r.Info.URL, r.Info.Genres}
+	}
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// lookupAlbumsMapped looks up albums like lookupAlbums, except that queries
+// found in mapping are resolved from it without any requests. done is called
+// for each album looked up.
+func (c *Client) lookupAlbumsMapped(ctx context.Context, as []artistAlbum, mapping map[string]mappingEntry, done func(BatchResult)) []BatchResult {
+	var rest []artistAlbum
+	for _, aa := range as {
+		if _, ok := mapping[aa.both]; !ok {
+			rest = append(rest, aa)
+		}
+	}
+	looked := c.lookupAlbumsFunc(ctx, rest, c.searchLookup, done)
+
+	result := make([]BatchResult, len(as))
+	for i, aa := range as {
+		e, ok := mapping[aa.both]
+		if !ok {
+			result[i], looked = looked[0], looked[1:]
+			continue
+		}
+		info := &AlbumInfo{Title: e.Title, URL: e.URL, Genres: e.Genres}
+		result[i] = BatchResult{Query: aa.both, Info: c.normalizeInfo(info), query: aa}
+	}
+	return result
+}
+
+// checkpoint records albums as they are resolved to a file, one JSON object
+// per line, so that an interrupted batch can be resumed with -resume.
+type checkpoint struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openCheckpoint reads albums resolved so far from the checkpoint at path and
+// opens it for appending, creating it if it doesn't exist.
+func openCheckpoint(path string) (*checkpoint, map[string]mappingEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	mapping := make(map[string]mappingEntry)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var e mappingEntry
+		// The last line is cut short if the run was killed while writing it.
+		if json.Unmarshal(s.Bytes(), &e) == nil && e.Query != "" {
+			mapping[e.Query] = e
+		}
+	}
+	if err := s.Err(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	// Start on a new line after a line cut short.
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			f.Write([]byte{'\n'})
+		}
+	}
+	return &checkpoint{f: f, enc: json.NewEncoder(f)}, mapping, nil
+}
+
+// record appends r to the checkpoint if the album was resolved. Albums without
+// genres are looked up again on resume.
+func (cp *checkpoint) record(r BatchResult) {
+	if r.Info == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.enc.Encode(mappingEntry{r.Query, r.Info.Title, r.Info.URL, r.Info.Genres})
+}
+
+func (cp *checkpoint) Close() error {
+	return cp.f.Close()
+}
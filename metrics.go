@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// Metrics receives counters and observations from a Client, e.g. to export
+// them to a monitoring system. Implementations must be safe for concurrent
+// use.
+//
+// Counters incremented by the client are "requests", "retries",
+// "cache.hits", "cache.misses", and errors by type: "errors.network",
+// "errors.http" and "errors.body". The "genres" observation is the number of
+// genres scraped from a page. The "latency.search" and "latency.page"
+// observations are durations of searches and page downloads in seconds,
+// including retries, fit for a histogram.
+type Metrics interface {
+	Increment(name string)
+	Observe(name string, value float64)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Increment(name string)              {}
+func (nopMetrics) Observe(name string, value float64) {}
+
+// WithMetrics makes the client report its counters to m. By default metrics
+// are discarded.
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// observeSince reports time elapsed since start in seconds as observation
+// name.
+func (c *Client) observeSince(name string, start time.Time) {
+	c.metrics.Observe(name, time.Since(start).Seconds())
+}
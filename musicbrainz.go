@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	musicBrainzBaseURL  = "https://musicbrainz.org/ws/2/"
+	wikidataAPIURL      = "https://www.wikidata.org/w/api.php"
+	musicBrainzInterval = time.Second
+)
+
+// ErrUnknownBarcode is returned if MusicBrainz has no release with the given
+// barcode.
+var ErrUnknownBarcode = fmt.Errorf("no release with this barcode on MusicBrainz")
+
+// AlbumGenresByBarcode looks up genres of the album with UPC or EAN barcode
+// using DefaultClient.
+func AlbumGenresByBarcode(barcode string) ([]string, error) {
+	return DefaultClient.AlbumGenresByBarcode(barcode)
+}
+
+// AlbumGenresByBarcode resolves UPC or EAN barcode to a release group on
+// MusicBrainz and scrapes genres from the Wikipedia article it links to,
+// directly or through Wikidata. If there's no such link, the album is searched
+// for by artist and title of the release. Requests to MusicBrainz are limited
+// to one per second as required by its terms.
+func (c *Client) AlbumGenresByBarcode(barcode string) ([]string, error) {
+	ctx := context.Background()
+	release, err := c.releaseByBarcode(ctx, barcode)
+	if err != nil {
+		return nil, err
+	}
+	title, err := c.releaseGroupArticle(ctx, release.ReleaseGroup.ID)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		var artist string
+		if len(release.ArtistCredit) > 0 {
+			artist = release.ArtistCredit[0].Name
+		}
+		return c.AlbumGenres(artist, release.Title)
+	}
+	return c.GenresFromURL(c.articleBaseURL + escapeTitle(title))
+}
+
+type mbRelease struct {
+	Title        string
+	ArtistCredit []struct {
+		Name string
+	} `json:"artist-credit"`
+	ReleaseGroup struct {
+		ID string
+	} `json:"release-group"`
+}
+
+// releaseByBarcode returns the first MusicBrainz release with barcode.
+func (c *Client) releaseByBarcode(ctx context.Context, barcode string) (*mbRelease, error) {
+	var resp struct {
+		Releases []mbRelease
+	}
+	err := c.queryMusicBrainz(ctx, "release", url.Values{"query": {"barcode:" + barcode}}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Releases) == 0 {
+		return nil, ErrUnknownBarcode
+	}
+	return &resp.Releases[0], nil
+}
+
+// releaseGroupArticle returns title of the article about release group in the
+// client's language, or an empty string if MusicBrainz doesn't link to one.
+func (c *Client) releaseGroupArticle(ctx context.Context, id string) (string, error) {
+	var resp struct {
+		Relations []struct {
+			Type string
+			URL  struct {
+				Resource string
+			}
+		}
+	}
+	err := c.queryMusicBrainz(ctx, "release-group/"+url.QueryEscape(id), url.Values{"inc": {"url-rels"}}, &resp)
+	if err != nil {
+		return "", err
+	}
+	var item string
+	for _, rel := range resp.Relations {
+		switch rel.Type {
+		case "wikipedia":
+			u, err := url.Parse(rel.URL.Resource)
+			if err == nil && strings.HasPrefix(u.Host, c.language+".") {
+				return articleTitle(rel.URL.Resource), nil
+			}
+		case "wikidata":
+			item = rel.URL.Resource[strings.LastIndex(rel.URL.Resource, "/")+1:]
+		}
+	}
+	if item == "" {
+		return "", nil
+	}
+	return c.wikidataSitelink(ctx, item)
+}
+
+// wikidataSitelink returns title of the article about Wikidata item in the
+// client's language, or an empty string if there's none.
+func (c *Client) wikidataSitelink(ctx context.Context, item string) (string, error) {
+	site := c.language + "wiki"
+	var resp struct {
+		Entities map[string]struct {
+			Sitelinks map[string]struct {
+				Title string
+			}
+		}
+	}
+	err := c.queryAPI(ctx, wikidataAPIURL, url.Values{
+		"action":     {"wbgetentities"},
+		"ids":        {item},
+		"props":      {"sitelinks"},
+		"sitefilter": {site},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Entities[item].Sitelinks[site].Title, nil
+}
+
+// queryMusicBrainz sends a request to MusicBrainz web service resource and
+// decodes JSON response into v.
+func (c *Client) queryMusicBrainz(ctx context.Context, resource string, params url.Values, v interface{}) error {
+	c.musicBrainzLimiter.wait()
+	params.Set("fmt", "json")
+	resp, err := c.get(ctx, musicBrainzBaseURL+resource, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !isResponseOK(resp) {
+		return fmt.Errorf("request to MusicBrainz failed, HTTP status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// rateLimiter spaces calls to wait at least interval apart.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (l *rateLimiter) wait() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d := l.interval - time.Since(l.last); d > 0 {
+		time.Sleep(d)
+	}
+	l.last = time.Now()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// negativeCache remembers albums found to have no genres, so that runs
+// within ttl of the lookup skip them, see -negative-cache.
+type negativeCache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]time.Time // album key to time of lookup
+}
+
+// openNegativeCache reads the negative cache from the JSON file at path. A
+// missing file is an empty cache.
+func openNegativeCache(path string, ttl time.Duration) (*negativeCache, error) {
+	nc := &negativeCache{path: path, ttl: ttl, entries: make(map[string]time.Time)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &nc.entries); err != nil {
+		return nil, err
+	}
+	return nc, nil
+}
+
+// albumKey identifies an album regardless of the input format it was read
+// in.
+func albumKey(artist, album string) string {
+	if artist == "" {
+		return album
+	}
+	return artist + " - " + album
+}
+
+// known tells whether the album had no genres within ttl.
+func (nc *negativeCache) known(artist, album string) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	t, ok := nc.entries[albumKey(artist, album)]
+	return ok && time.Since(t) < nc.ttl
+}
+
+// record remembers the album of r if it has no genres and forgets it if it
+// has some.
+func (nc *negativeCache) record(r BatchResult) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	key := albumKey(r.query.artist, r.query.album)
+	switch {
+	case r.Err == ErrNoGenres:
+		nc.entries[key] = time.Now()
+	case r.Info != nil:
+		delete(nc.entries, key)
+	}
+}
+
+// save writes unexpired entries to the cache file.
+func (nc *negativeCache) save() error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for key, t := range nc.entries {
+		if time.Since(t) >= nc.ttl {
+			delete(nc.entries, key)
+		}
+	}
+	data, err := json.MarshalIndent(nc.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(nc.path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokens that keep their spelling when genres are title-cased.
+var defaultPreservedTokens = []string{
+	"EDM", "IDM", "EBM", "UK", "US", "DJ", "R&B", "MPB", "J-pop", "K-pop", "C-pop",
+}
+
+// Common genres looked for in the lead paragraph, see WithLeadGenres.
+var defaultGenreLexicon = []string{
+	"alternative rock", "ambient", "art rock", "black metal", "blues", "blues rock",
+	"bossa nova", "country", "dance", "death metal", "disco", "doom metal",
+	"drum and bass", "dub", "dubstep", "electronic", "electropop", "emo", "folk",
+	"folk rock", "funk", "garage rock", "gospel", "grindcore", "grunge",
+	"hard rock", "hardcore punk", "heavy metal", "hip hop", "house", "indie pop",
+	"indie rock", "industrial", "jazz", "jazz fusion", "krautrock", "metalcore",
+	"new wave", "noise rock", "nu metal", "pop", "pop punk", "pop rock",
+	"post-punk", "post-rock", "power metal", "progressive metal",
+	"progressive rock", "psychedelic rock", "punk rock", "R&B", "rap", "reggae",
+	"rock", "shoegaze", "ska", "soul", "soft rock", "stoner rock", "synth-pop",
+	"techno", "thrash metal", "trance", "trip hop",
+}
+
+// WithPreservedTokens adds words that title-casing must spell exactly as
+// given, e.g. "EDM" or "J-pop". Matching is case-insensitive.
+func WithPreservedTokens(tokens ...string) Option {
+	return func(c *Client) {
+		for _, token := range tokens {
+			c.preservedTokens[strings.ToLower(token)] = token
+		}
+	}
+}
+
+// Case is the casing applied to scraped genres.
+//
+// Genres are scraped as the raw text of infobox links with only surrounding
+// whitespace trimmed. Casing is a transform layered on top of that, as is
+// sorting. With PreserveCase the raw text is returned as is, e.g. "Hip hop
+// music" or "Rock (music)" if that's what the link says, which is what to use
+// for citations. Genres repeated on the page are still listed once. Other
+// casings also drop disambiguation qualifiers like "(music)".
+type Case int
+
+// Genre casings. TitleCase is the default. TitleProperCase capitalizes every
+// word including parts of hyphenated ones, lower-cases the rest of each word
+// and leaves contractions like "'n'" alone, e.g. "Rock 'n' Roll" and
+// "Post-Punk". Its rules for the letter i follow WithTitleLanguage.
+const (
+	TitleCase Case = iota
+	LowerCase
+	PreserveCase
+	TitleProperCase
+)
+
+var caseNames = []string{
+	TitleCase:       "title",
+	LowerCase:       "lower",
+	PreserveCase:    "preserve",
+	TitleProperCase: "title-proper",
+}
+
+func (gc Case) String() string {
+	return caseNames[gc]
+}
+
+// Set implements flag.Value.
+func (gc *Case) Set(s string) error {
+	for i, name := range caseNames {
+		if s == name {
+			*gc = Case(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown case %q, want one of %s", s, strings.Join(caseNames, ", "))
+}
+
+// WithCase sets casing of returned genres. PreserveCase keeps genres exactly
+// the way they're spelled on Wikipedia.
+func WithCase(gc Case) Option {
+	return func(c *Client) {
+		c.genreCase = gc
+	}
+}
+
+// WithSortedGenres sorts genres alphabetically, ignoring case. By default
+// genres are listed in the order they appear in the infobox.
+func WithSortedGenres() Option {
+	return func(c *Client) {
+		c.sortGenres = true
+	}
+}
+
+// Genres too broad to be useful next to more specific ones, see
+// WithoutUmbrellaGenres.
+var defaultUmbrellaGenres = []string{"Music", "Popular music", "Rock music", "Pop music", "Rock", "Pop"}
+
+// WithoutUmbrellaGenres drops broad genres such as "Rock music" from albums
+// that have more specific genres too. Albums with umbrella genres only keep
+// them. Genres are compared ignoring case after disambiguation qualifiers are
+// dropped. If genres is empty, "Music", "Popular music", "Rock music", "Pop
+// music", "Rock" and "Pop" are dropped.
+func WithoutUmbrellaGenres(genres ...string) Option {
+	return func(c *Client) {
+		if len(genres) == 0 {
+			genres = defaultUmbrellaGenres
+		}
+		c.umbrellaGenres = make(map[string]bool)
+		for _, g := range genres {
+			c.umbrellaGenres[strings.ToLower(g)] = true
+		}
+	}
+}
+
+// dropUmbrellaGenres returns genres without umbrella ones, or all genres if
+// they're all umbrella ones.
+func (c *Client) dropUmbrellaGenres(genres []string) []string {
+	var result []string
+	for _, g := range genres {
+		if !c.umbrellaGenres[strings.ToLower(reGenreQualifier.ReplaceAllString(g, ""))] {
+			result = append(result, g)
+		}
+	}
+	if len(result) == 0 {
+		return genres
+	}
+	return result
+}
+
+// normalizeInfo normalizes genres and styles of info in place.
+func (c *Client) normalizeInfo(info *AlbumInfo) *AlbumInfo {
+	if c.umbrellaGenres != nil {
+		info.Genres = c.dropUmbrellaGenres(info.Genres)
+	}
+	info.Primary = ""
+	if len(info.Genres) > 0 {
+		info.Primary = c.normalizeGenre(info.Genres[0])
+	}
+	info.Genres = c.normalizeGenres(info.Genres)
+	info.Secondary = make([]string, 0, len(info.Genres))
+	for _, g := range info.Genres {
+		if !strings.EqualFold(g, info.Primary) {
+			info.Secondary = append(info.Secondary, g)
+		}
+	}
+	info.Styles = c.normalizeGenres(info.Styles)
+	info.Untranslated = c.normalizeGenres(info.Untranslated)
+	if info.Redirects == nil {
+		info.Redirects = []string{}
+	}
+	if info.GenreLinks == nil {
+		info.GenreLinks = []GenreLink{}
+	}
+	if info.Languages == nil {
+		info.Languages = []string{}
+	}
+	for i := range info.GenreLinks {
+		info.GenreLinks[i].Genre = c.normalizeGenre(info.GenreLinks[i].Genre)
+	}
+	return info
+}
+
+// normalizeGenres applies the client's transforms to scraped genres and drops
+// duplicates, comparing case-insensitively.
+func (c *Client) normalizeGenres(genres []string) []string {
+	result := make([]string, 0, len(genres))
+	seen := make(map[string]bool)
+	for _, g := range genres {
+		g = c.normalizeGenre(g)
+		key := strings.ToLower(g)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, g)
+	}
+	if c.sortGenres {
+		sort.Sort(byLowercase(result))
+	}
+	return result
+}
+
+// Disambiguation qualifiers of genre articles, e.g. "(music)" in "Rock
+// (music)". Other parentheses are kept as they may be part of the genre.
+var reGenreQualifier = regexp.MustCompile(`(?i)\s*\((music|genre|music genre|musical genre|style|music style)\)$`)
+
+// normalizeGenre applies the client's casing to genre. Unless the case is
+// PreserveCase, the disambiguation qualifier is stripped as well.
+func (c *Client) normalizeGenre(genre string) string {
+	if c.genreCase == PreserveCase {
+		return genre
+	}
+	return c.applyCase(reGenreQualifier.ReplaceAllString(genre, ""))
+}
+
+type byLowercase []string
+
+func (s byLowercase) Len() int           { return len(s) }
+func (s byLowercase) Less(i, j int) bool { return strings.ToLower(s[i]) < strings.ToLower(s[j]) }
+func (s byLowercase) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (c *Client) applyCase(s string) string {
+	switch c.genreCase {
+	case LowerCase:
+		return strings.ToLower(s)
+	case PreserveCase:
+		return s
+	case TitleProperCase:
+		return c.properTitle(s)
+	}
+	return c.title(s)
+}
+
+// title upper-cases only the first letter of each word. Preserved tokens are
+// replaced with their canonical spelling, and only the first part of
+// hyphenated words like "nu-metal" is capitalized.
+func (c *Client) title(s string) string {
+	parts := strings.Fields(s)
+	for i, part := range parts {
+		if token, ok := c.preservedTokens[strings.ToLower(part)]; ok {
+			parts[i] = token
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(part)
+		parts[i] = string(unicode.ToUpper(r)) + part[size:]
+	}
+	return strings.Join(parts, " ")
+}
+
+// WithTitleLanguage sets the language of genres for TitleProperCase as a
+// BCP 47 tag such as "tr" or "tr-CY", of which only the primary language
+// subtag counts. Turkish ("tr") and Azerbaijani ("az") are the only
+// languages with casing rules of their own: "i" is capitalized as "İ" and
+// "I" is lower-cased as "ı". Any other tag, like not setting the language at
+// all, gets the default Unicode casing, where "i" and "I" pair up.
+func WithTitleLanguage(lang string) Option {
+	return func(c *Client) {
+		c.titleCaser = unicode.SpecialCase(nil)
+		switch strings.ToLower(strings.SplitN(lang, "-", 2)[0]) {
+		case "tr":
+			c.titleCaser = unicode.TurkishCase
+		case "az":
+			c.titleCaser = unicode.AzeriCase
+		}
+	}
+}
+
+// properTitle capitalizes the first letter of each word, where words are
+// separated by anything but letters, digits and apostrophes, and lower-cases
+// the rest. A letter right after an apostrophe isn't capitalized, so "'n'"
+// stays as is. Preserved tokens are replaced with their canonical spelling.
+func (c *Client) properTitle(s string) string {
+	parts := strings.Fields(s)
+	for i, part := range parts {
+		if token, ok := c.preservedTokens[strings.ToLower(part)]; ok {
+			parts[i] = token
+			continue
+		}
+		runes := []rune(part)
+		wordStart := true
+		for j, r := range runes {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				if wordStart {
+					runes[j] = c.titleCaser.ToTitle(r)
+				} else {
+					runes[j] = c.titleCaser.ToLower(r)
+				}
+				wordStart = false
+			case r == '\'' || r == '’':
+				wordStart = false
+			default:
+				wordStart = true
+			}
+		}
+		parts[i] = string(runes)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
+)
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		genre, want string
+	}{
+		{"alternative rock", "Alternative Rock"},
+		{"edm", "EDM"},
+		{"Edm", "EDM"},
+		{"idm", "IDM"},
+		{"uk garage", "UK Garage"},
+		{"j-pop", "J-pop"},
+		{"J-Pop", "J-pop"},
+		{"k-pop", "K-pop"},
+		{"nu-metal", "Nu-metal"},
+		{"r&b", "R&B"},
+		{"  hip   hop ", "Hip Hop"},
+	}
+	c := NewClient()
+	for _, tt := range tests {
+		if got := c.title(tt.genre); got != tt.want {
+			t.Errorf("title(%q) = %q, want %q", tt.genre, got, tt.want)
+		}
+	}
+}
+
+func TestTitlePreservedTokens(t *testing.T) {
+	c := NewClient(WithPreservedTokens("8-bit", "NWOBHM"))
+	tests := []struct {
+		genre, want string
+	}{
+		{"8-BIT", "8-bit"},
+		{"nwobhm", "NWOBHM"},
+		{"edm", "EDM"},
+	}
+	for _, tt := range tests {
+		if got := c.title(tt.genre); got != tt.want {
+			t.Errorf("title(%q) = %q, want %q", tt.genre, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGenresQualifiers(t *testing.T) {
+	tests := []struct {
+		gc   Case
+		want []string
+	}{
+		{TitleCase, []string{"Ambient", "Techno", "Intelligent Dance Music (IDM)"}},
+		{LowerCase, []string{"ambient", "techno", "intelligent dance music (idm)"}},
+		{PreserveCase, []string{"Ambient (music)", "Techno (genre)", "intelligent dance music (IDM)"}},
+	}
+	doc := loadPage(t, "qualifiers")
+	for _, tt := range tests {
+		c := NewClient(WithCase(tt.gc))
+		genres, _ := c.scrapeGenres(doc)
+		if got := c.normalizeGenres(genres); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.gc, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGenreQualifiers(t *testing.T) {
+	tests := []struct {
+		genre, want string
+	}{
+		{"Rock (music)", "Rock"},
+		{"Pop (genre)", "Pop"},
+		{"Dub (music genre)", "Dub"},
+		{"Rock (UK)", "Rock (UK)"},
+		{"Intelligent dance music (IDM)", "Intelligent Dance Music (IDM)"},
+	}
+	c := NewClient()
+	for _, tt := range tests {
+		if got := c.normalizeGenre(tt.genre); got != tt.want {
+			t.Errorf("normalizeGenre(%q) = %q, want %q", tt.genre, got, tt.want)
+		}
+	}
+}
+
+func TestPreserveCaseRawText(t *testing.T) {
+	const page = `<table class="infobox"><tr><th>Genre</th><td>
+		<a href="/wiki/Hip_hop_music">
+			Hip hop music
+		</a>,
+		<a href="/wiki/Rock_music">Rock (music)</a>,
+		<a href="/wiki/J-pop">j-pop</a>,
+		<a href="/wiki/Electronic_dance_music">edm</a>
+	</td></tr></table>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(WithCase(PreserveCase))
+	info := c.normalizeInfo(c.scrapeAlbumInfo(doc))
+	want := []string{"Hip hop music", "Rock (music)", "j-pop", "edm"}
+	if !reflect.DeepEqual(info.Genres, want) {
+		t.Errorf("got genres %q, want %q", info.Genres, want)
+	}
+	if info.Primary != want[0] {
+		t.Errorf("got primary genre %q, want %q", info.Primary, want[0])
+	}
+}
+
+func TestNormalizeInfoEmptySlices(t *testing.T) {
+	info := NewClient().normalizeInfo(&AlbumInfo{Genres: []string{"Grunge"}})
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"GenreLinks":[]`, `"Languages":[]`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("got %s, want %s", data, field)
+		}
+	}
+}
+
+func TestWithTitleLanguage(t *testing.T) {
+	tests := []struct {
+		lang, genre, want string
+	}{
+		{"tr", "istanbul ışık", "İstanbul Işık"},
+		{"tr", "IŞIK MÜZİĞİ", "Işık Müziği"},
+		{"tr-CY", "istanbul", "İstanbul"},
+		{"az", "inqilab", "İnqilab"},
+		{"", "istanbul ışık", "Istanbul Işık"},
+		{"", "IŞIK", "Işik"},
+		{"de", "istanbul", "Istanbul"},
+	}
+	for _, tt := range tests {
+		c := NewClient(WithCase(TitleProperCase), WithTitleLanguage(tt.lang))
+		if got := c.normalizeGenre(tt.genre); got != tt.want {
+			t.Errorf("%q in %q: got %q, want %q", tt.genre, tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// outputFormat selects how results are printed to stdout.
+type outputFormat string
+
+// resultPrinter prints results one by one in input order.
+type resultPrinter interface {
+	Print(r BatchResult)
+}
+
+var resultPrinters = map[outputFormat]func(io.Writer) resultPrinter{
+	"text":         func(w io.Writer) resultPrinter { return textPrinter{w, withTitle, notFoundText} },
+	"lines":        func(w io.Writer) resultPrinter { return &linesPrinter{w: w} },
+	"m3u-comments": func(w io.Writer) resultPrinter { return m3uPrinter{w} },
+}
+
+func (f outputFormat) String() string {
+	return string(f)
+}
+
+// Set implements flag.Value.
+func (f *outputFormat) Set(s string) error {
+	if _, ok := resultPrinters[outputFormat(s)]; !ok {
+		return fmt.Errorf("unknown output format %q, want text, lines or m3u-comments", s)
+	}
+	*f = outputFormat(s)
+	return nil
+}
+
+func newResultPrinter(format outputFormat, w io.Writer) resultPrinter {
+	return resultPrinters[format](w)
+}
+
+// textPrinter prints genres of each album on a single line separated by
+// semicolons, optionally preceded by the query and a tab. Albums without
+// genres are printed as notFound, empty queries and skipped albums as empty
+// lines.
+type textPrinter struct {
+	w         io.Writer
+	withTitle bool
+	notFound  string
+}
+
+func (p textPrinter) Print(r BatchResult) {
+	if p.withTitle {
+		fmt.Fprintf(p.w, "%s\t", r.Query)
+	}
+	genres := r.Genres()
+	if len(genres) == 0 && r.Query != "" && !r.Skipped {
+		fmt.Fprintln(p.w, p.notFound)
+		return
+	}
+	fmt.Fprintln(p.w, strings.Join(genres, "; "))
+}
+
+// linesPrinter prints each genre on its own line, separating albums with a
+// blank line.
+type linesPrinter struct {
+	w       io.Writer
+	started bool
+}
+
+func (p *linesPrinter) Print(r BatchResult) {
+	if p.started {
+		fmt.Fprintln(p.w)
+	}
+	p.started = true
+	for _, g := range r.Genres() {
+		fmt.Fprintln(p.w, g)
+	}
+}
+
+// m3uPrinter prints genres of each album as an extended M3U comment, e.g.
+// "#EXTGENRE:Nevermind=Grunge,Alternative Rock". Albums without genres are
+// left out.
+type m3uPrinter struct {
+	w io.Writer
+}
+
+func (p m3uPrinter) Print(r BatchResult) {
+	genres := r.Genres()
+	if len(genres) == 0 {
+		return
+	}
+	album := r.query.album
+	if album == "" {
+		album = r.Query
+	}
+	fmt.Fprintf(p.w, "#EXTGENRE:%s=%s\n", album, strings.Join(genres, ","))
+}
+
+// templatePrinter executes a template for each result, followed by a newline.
+type templatePrinter struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+// templateResult is what output templates are executed with.
+type templateResult struct {
+	Query, Artist, Album string
+	Genres               []string
+	URL                  string
+	Error                string
+	Skipped              bool
+}
+
+var templateFuncs = template.FuncMap{
+	"join": func(a []string, sep string) string { return strings.Join(a, sep) },
+}
+
+func newTemplatePrinter(w io.Writer, text string) (resultPrinter, error) {
+	tmpl, err := template.New("result").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return templatePrinter{w, tmpl}, nil
+}
+
+func (p templatePrinter) Print(r BatchResult) {
+	tr := templateResult{
+		Query:   r.Query,
+		Artist:  r.query.artist,
+		Album:   r.query.album,
+		Genres:  r.Genres(),
+		Skipped: r.Skipped,
+	}
+	if r.Info != nil {
+		tr.URL = r.Info.URL
+	}
+	if r.Err != nil {
+		tr.Error = r.Err.Error()
+	}
+	if err := p.tmpl.Execute(p.w, tr); err != nil {
+		errLogger.Error(r.Query, err)
+	}
+	fmt.Fprintln(p.w)
+}
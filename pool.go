@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithIdleConnsPerHost sets how many idle connections to Wikipedia are kept
+// for reuse. Go keeps 2 by default, so a batch with more lookups in flight,
+// e.g. -stream with the default -j 8, keeps opening and closing connections;
+// setting n to the number of concurrent lookups avoids that. Like
+// WithConnectTimeout, it has no effect with WithHTTPClient or WithTransport.
+func WithIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.idleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost limits how many connections to each host are open at
+// once. Requests beyond the limit wait for one of the requests in flight to
+// the same host to finish, i.e. for its response body to be closed, or give
+// up when their context is done. At most n idle connections per host are
+// kept, so idle connections never take up more than the limit. Defaults to 0,
+// no limit; a limit of 2 to 4 is polite for long unattended runs. Like
+// WithConnectTimeout, it has no effect with WithHTTPClient or WithTransport.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// limitedTransport sends requests with base, allowing at most max requests
+// in flight per host. A request is in flight until its response body is
+// closed.
+type limitedTransport struct {
+	base *http.Transport
+	max  int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := t.hostSlots(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-req.Cancel:
+		return nil, errRequestCanceled
+	}
+	release := func() { <-slots }
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// hostSlots returns the semaphore of requests in flight to host.
+func (t *limitedTransport) hostSlots(host string) chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.slots == nil {
+		t.slots = make(map[string]chan struct{})
+	}
+	slots, ok := t.slots[host]
+	if !ok {
+		slots = make(chan struct{}, t.max)
+		t.slots[host] = slots
+	}
+	return slots
+}
+
+// CloseIdleConnections closes idle connections of the underlying transport.
+func (t *limitedTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+var errRequestCanceled = errors.New("request canceled while waiting for a connection")
+
+// releasingBody frees the slot of its request in limitedTransport when
+// closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
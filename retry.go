@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// WithRetryBudget bounds retries shared by all lookups of the client, so that
+// during a broad slowdown of Wikipedia every album retrying on its own doesn't
+// multiply the load. The budget holds up to burst retries and is refilled by
+// one retry every interval. Once it's exhausted, failed requests are not
+// retried until it's refilled. By default retries are only bounded per
+// request, see WithRetries.
+func WithRetryBudget(burst int, interval time.Duration) Option {
+	return func(c *Client) {
+		c.retryBudget = &tokenBucket{
+			tokens:   float64(burst),
+			max:      float64(burst),
+			interval: interval,
+			last:     time.Now(),
+		}
+	}
+}
+
+// tokenBucket is a token bucket refilled by one token every interval.
+type tokenBucket struct {
+	max      float64
+	interval time.Duration
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token and tells whether there was one.
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.interval > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > b.max {
+			b.tokens = b.max
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// WithJitterSource sets the source of randomness retry delays are jittered
+// with, see WithRetries. By default it's seeded with the current time; a
+// fixed seed, e.g. rand.NewSource(1), makes delays reproducible in tests.
+func WithJitterSource(src rand.Source) Option {
+	return func(c *Client) {
+		c.jitter = &jitter{rand: rand.New(src)}
+	}
+}
+
+// jitter randomizes delays. It's safe for concurrent use unlike rand.Rand.
+type jitter struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// apply returns a random duration from d/2 up to d.
+func (j *jitter) apply(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return d/2 + time.Duration(j.rand.Int63n(int64(d-d/2)))
+}
+
+// retryWait returns the delay before retry attempt, counting from 1.
+func (c *Client) retryWait(attempt int) time.Duration {
+	return c.jitter.apply(c.retryDelay << uint(attempt-1))
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/golang.org/x/net/html"
+)
+
+// GenreSource tells which part of the album page genres were scraped from.
+type GenreSource string
+
+// Genre sources in the order they are tried.
+const (
+	SourceHAudio      GenreSource = "haudio"
+	SourceInfobox     GenreSource = "infobox"
+	SourceDBpedia     GenreSource = "dbpedia"
+	SourceCategories  GenreSource = "categories"
+	SourceShortDesc   GenreSource = "shortdesc"
+	SourceLead        GenreSource = "lead"
+	SourceDiscography GenreSource = "discography"
+)
+
+// Confidence of genres found in a source, from 0 to 1. DBpedia is a second
+// hand account of the infobox. Categories are only a hint of the genre, so
+// they are trusted less than the infobox. A row of the artist's discography
+// table is an overview maintained apart from the album. Genres found
+// in the short description or the lead paragraph are merely inferred.
+func (s GenreSource) Confidence() float64 {
+	switch s {
+	case SourceHAudio, SourceInfobox:
+		return 1
+	case SourceDBpedia:
+		return 0.9
+	case SourceDiscography:
+		return 0.7
+	case SourceCategories:
+		return 0.5
+	case SourceShortDesc:
+		return 0.4
+	case SourceLead:
+		return 0.3
+	}
+	return 0
+}
+
+// Selectors are CSS selectors used to find genres on album pages.
+type Selectors struct {
+	// HAudioGenres matches genre links of the hAudio microformat table.
+	HAudioGenres string
+	// Infobox matches the infobox table.
+	Infobox string
+	// InfoboxLabel matches labels of infobox rows, compared to genre labels.
+	InfoboxLabel string
+	// InfoboxGenres matches genre links within the genre row.
+	InfoboxGenres string
+	// Categories matches links to article categories.
+	Categories string
+}
+
+// DefaultSelectors match markup of the English Wikipedia.
+var DefaultSelectors = Selectors{
+	HAudioGenres:  "table.haudio td.category a",
+	Infobox:       "table.infobox",
+	InfoboxLabel:  "th>a",
+	InfoboxGenres: "td a",
+	Categories:    "#mw-normal-catlinks li a",
+}
+
+// WithoutHAudio stops scraping genres from the hAudio microformat, so that
+// they come from the infobox row instead, e.g. to tell which of the two
+// yields wrong genres on a page.
+func WithoutHAudio() Option {
+	return func(c *Client) {
+		c.scrapeHAudio = false
+	}
+}
+
+// WithoutInfobox stops scraping genres from the infobox row, so that they
+// only come from the hAudio microformat or sources less trustworthy than the
+// infobox.
+func WithoutInfobox() Option {
+	return func(c *Client) {
+		c.scrapeInfobox = false
+	}
+}
+
+// WithSelectors overrides selectors used to scrape genres, so the scraper can
+// be adapted to markup changes or other wikis. Empty fields of s keep their
+// defaults, see DefaultSelectors.
+func WithSelectors(s Selectors) Option {
+	return func(c *Client) {
+		set := func(dst *string, src string) {
+			if src != "" {
+				*dst = src
+			}
+		}
+		set(&c.selectors.HAudioGenres, s.HAudioGenres)
+		set(&c.selectors.Infobox, s.Infobox)
+		set(&c.selectors.InfoboxLabel, s.InfoboxLabel)
+		set(&c.selectors.InfoboxGenres, s.InfoboxGenres)
+		set(&c.selectors.Categories, s.Categories)
+	}
+}
+
+var reYear = regexp.MustCompile(`\b(1[89]|20)\d\d\b`)
+
+func (c *Client) scrapeAlbumInfo(doc *goquery.Document) *AlbumInfo {
+	genres, source := c.scrapeGenres(doc)
+	info := &AlbumInfo{
+		Title:      scrapeTitle(doc),
+		Genres:     genres,
+		Source:     source,
+		Confidence: source.Confidence(),
+		Type:       c.scrapeReleaseType(doc),
+		Released:   c.infoboxRowText(doc, "Released"),
+		Recorded:   c.infoboxRowText(doc, "Recorded"),
+		Studio:     c.infoboxRowText(doc, "Studio"),
+		Country:    c.infoboxRowText(doc, "Country"),
+	}
+	if info.Country == "" {
+		info.Country = c.infoboxRowText(doc, "Origin")
+	}
+	if year := reYear.FindString(info.Released); year != "" {
+		info.Year, _ = strconv.Atoi(year)
+	}
+	if c.styles {
+		info.Styles = c.infoboxRowValues(doc, "Styles")
+	}
+	if c.shortDesc {
+		info.Description = shortDescription(doc)
+	}
+	info.CoverURL = c.scrapeCoverURL(doc)
+	if c.genreIDs {
+		info.linkTargets = c.linkTargets(doc)
+	}
+	return info
+}
+
+// scrapeCoverURL returns the absolute URL of the image in the album infobox,
+// or an empty string if there's none.
+func (c *Client) scrapeCoverURL(doc *goquery.Document) string {
+	infobox := c.albumInfobox(doc)
+	img := infobox.Find(".infobox-image img").First()
+	if img.Length() == 0 {
+		img = infobox.Find("img").First()
+	}
+	src, ok := img.Attr("src")
+	if !ok {
+		return ""
+	}
+	base, err := url.Parse(c.articleBaseURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Selectors of the article heading on desktop and mobile pages.
+const titleSelector = "#firstHeading, #section_0, .mw-page-title-main"
+
+// scrapeTitle returns the title of the article as displayed in its heading.
+func scrapeTitle(doc *goquery.Document) string {
+	return strings.TrimSpace(doc.Find(titleSelector).First().Text())
+}
+
+// scrapeGenres tries sources of genres in order until one yields any. A
+// source that fails on a document the parser could only make partial sense
+// of, e.g. one cut short, is skipped rather than failing the rest.
+func (c *Client) scrapeGenres(doc *goquery.Document) ([]string, GenreSource) {
+	if doc == nil || c.isGenreArticle(doc) {
+		return nil, ""
+	}
+	var sources []genreScraper
+	if c.scrapeHAudio {
+		sources = append(sources, genreScraper{SourceHAudio, func() []string { return c.genreLinkTexts(doc.Find(c.selectors.HAudioGenres)) }})
+	}
+	if c.scrapeInfobox {
+		sources = append(sources, genreScraper{SourceInfobox, func() []string { return c.infoboxGenres(doc) }})
+	}
+	sources = append(sources, genreScraper{SourceCategories, func() []string { return scrapeCategoryGenres(doc, c.selectors.Categories, c.genreLexicon()) }})
+	if c.shortDesc {
+		sources = append(sources, genreScraper{SourceShortDesc, func() []string { return shortDescGenres(shortDescription(doc), c.genreMatcher()) }})
+	}
+	if c.leadMatcher != nil {
+		sources = append(sources, genreScraper{SourceLead, func() []string { return scrapeLeadGenres(doc, c.leadMatcher) }})
+	}
+	for _, s := range sources {
+		if result := tryScrape(s.scrape); len(result) > 0 {
+			return result, s.source
+		}
+	}
+	return nil, ""
+}
+
+// genreScraper scrapes genres from a single source.
+type genreScraper struct {
+	source GenreSource
+	scrape func() []string
+}
+
+// tryScrape calls scrape, treating a panic as no genres found.
+func tryScrape(scrape func() []string) (result []string) {
+	defer func() {
+		if p := recover(); p != nil {
+			result = nil
+		}
+	}()
+	return scrape()
+}
+
+// infoboxGenres returns links in the value cell of the infobox row labelled
+// with one of the genre labels. A row's label is the text of its heading, or
+// of an element of the heading matched by the label selector. Headings
+// without a value cell next to them are passed over.
+func (c *Client) infoboxGenres(doc *goquery.Document) []string {
+	rows := c.albumInfobox(doc).Find("tr")
+	for _, label := range c.genreLabels {
+		row := rows.FilterFunction(func(i int, row *goquery.Selection) bool {
+			return row.ChildrenFiltered("td").Length() > 0 && c.rowHasLabel(row, label)
+		}).First()
+		cell := row.ChildrenFiltered("td").First()
+		if cell.Length() == 0 {
+			continue
+		}
+		links := row.
+			Find(c.selectors.InfoboxGenres).
+			FilterFunction(func(i int, link *goquery.Selection) bool {
+				return cell.Contains(link.Get(0))
+			}).
+			FilterFunction(outsideNavigation)
+		if result := c.genreLinkTexts(links); len(result) > 0 {
+			return result
+		}
+	}
+	return nil
+}
+
+// rowHasLabel tells whether the heading of table row is label, ignoring
+// case.
+func (c *Client) rowHasLabel(row *goquery.Selection, label string) bool {
+	heading := row.ChildrenFiltered("th").First()
+	if heading.Length() == 0 {
+		return false
+	}
+	hasLabel := func(i int, s *goquery.Selection) bool {
+		return strings.EqualFold(strings.TrimSpace(s.Text()), label)
+	}
+	return hasLabel(0, heading) ||
+		row.Find(c.selectors.InfoboxLabel).FilterFunction(hasLabel).Length() > 0
+}
+
+// isGenreArticle tells whether the page describes a music genre rather than
+// an album, e.g. "Jazz" found when looking up an album named so. Subgenres and
+// fusion genres listed there must not be taken for genres of the album.
+func (c *Client) isGenreArticle(doc *goquery.Document) bool {
+	if doc.Find(c.releaseSelector()).Length() > 0 {
+		return false
+	}
+	if c.shortDesc {
+		desc := shortDescription(doc)
+		switch {
+		case reReleaseDesc.MatchString(desc):
+			return false
+		case reGenreDesc.MatchString(desc):
+			return true
+		}
+	}
+	return c.infoboxRow(doc, "Stylistic origins").Length() > 0 ||
+		c.infoboxRow(doc, "Cultural origins").Length() > 0
+}
+
+var (
+	reReleaseDesc = regexp.MustCompile(`(?i)\b(album|EP|single|soundtrack|mixtape|compilation)\b`)
+	reGenreDesc   = regexp.MustCompile(`(?i)\b(genre|subgenre|style of music)\b`)
+)
+
+// shortDescription returns the short description of the article, like "1991
+// studio album by Nirvana", or an empty string if there's none.
+func shortDescription(doc *goquery.Document) string {
+	return strings.TrimSpace(doc.Find(".shortdescription").First().Text())
+}
+
+// shortDescGenres looks for genre phrases of m in short description before
+// the release type, e.g. "grunge" in "1991 grunge album by Nirvana".
+func shortDescGenres(desc string, m *genreMatcher) []string {
+	loc := reReleaseDesc.FindStringIndex(desc)
+	if loc == nil {
+		return nil
+	}
+	return m.match(desc[:loc[0]])
+}
+
+var reAlbumsCategory = regexp.MustCompile(`^(.+) albums$`)
+
+// scrapeCategoryGenres extracts genres from article categories such as
+// "Thrash metal albums", whose links are matched by selector. Only categories
+// named after a genre of lexicon count, so that ones named after the artist or
+// the label, like "Sub Pop albums", don't.
+func scrapeCategoryGenres(doc *goquery.Document, selector string, lexicon []string) []string {
+	var result []string
+	doc.Find(selector).
+		Each(func(i int, link *goquery.Selection) {
+			matches := reAlbumsCategory.FindStringSubmatch(strings.TrimSpace(link.Text()))
+			if len(matches) == 0 {
+				return
+			}
+			for _, genre := range lexicon {
+				if strings.EqualFold(matches[1], genre) {
+					result = append(result, matches[1])
+					return
+				}
+			}
+		})
+	return result
+}
+
+// genreLinkTexts returns texts of genre links. With WithJoinedLinks, links
+// directly adjacent to each other make up a single genre.
+func (c *Client) genreLinkTexts(links *goquery.Selection) []string {
+	var result []string
+	if !c.joinLinks {
+		links.Each(textFromSelection(&result))
+		return result
+	}
+	var prev *html.Node
+	links.Each(func(i int, link *goquery.Selection) {
+		node := link.Get(0)
+		if prev != nil && len(result) > 0 && adjacentNodes(prev, node) {
+			result[len(result)-1] = strings.TrimSpace(result[len(result)-1] + gapText(prev, node) + link.Text())
+		} else {
+			result = append(result, strings.TrimSpace(link.Text()))
+		}
+		prev = node
+	})
+	return result
+}
+
+// adjacentNodes tells whether b follows a with only whitespace between them.
+func adjacentNodes(a, b *html.Node) bool {
+	for n := a.NextSibling; n != nil; n = n.NextSibling {
+		if n == b {
+			return true
+		}
+		if n.Type != html.TextNode || strings.TrimSpace(n.Data) != "" {
+			return false
+		}
+	}
+	return false
+}
+
+// gapText returns whitespace between adjacent nodes a and b collapsed to a
+// single space, or an empty string if there's none.
+func gapText(a, b *html.Node) string {
+	for n := a.NextSibling; n != b; n = n.NextSibling {
+		if n.Data != "" {
+			return " "
+		}
+	}
+	return ""
+}
+
+func textFromSelection(result *[]string) func(int, *goquery.Selection) {
+	return func(i int, link *goquery.Selection) {
+		*result = append(*result, strings.TrimSpace(link.Text()))
+	}
+}
+
+var reReleaseType = regexp.MustCompile(`^(.+?)\s+by\b`)
+
+// scrapeReleaseType extracts release type, e.g. "Studio album" or "Single",
+// from the description line of the infobox, like "Studio album by Nirvana".
+func (c *Client) scrapeReleaseType(doc *goquery.Document) string {
+	description := c.mainInfobox(doc).Find(".description").First()
+	if description.Length() == 0 {
+		description = doc.Find(c.releaseSelector()).Find(".description").First()
+	}
+	text := strings.Join(strings.Fields(description.Text()), " ")
+	if matches := reReleaseType.FindStringSubmatch(text); len(matches) > 0 {
+		return matches[1]
+	}
+	return text
+}
+
+// Classes of infoboxes of music releases, see WithReleaseInfoboxClasses.
+var defaultReleaseClasses = []string{"haudio"}
+
+// WithReleaseInfoboxClasses sets classes of tables that mark a page as being
+// about a music release, e.g. "infobox-music" on a wiki with its own
+// templates. A page with such a table is never mistaken for a genre article,
+// and genre rows are looked for in such tables as well as in the infobox.
+// Defaults to "haudio", the microformat of album, single and song infoboxes of
+// the English Wikipedia.
+func WithReleaseInfoboxClasses(classes ...string) Option {
+	return func(c *Client) {
+		if len(classes) == 0 {
+			classes = defaultReleaseClasses
+		}
+		c.releaseClasses = classes
+	}
+}
+
+// releaseSelector matches infoboxes of music releases.
+func (c *Client) releaseSelector() string {
+	selectors := make([]string, len(c.releaseClasses))
+	for i, class := range c.releaseClasses {
+		selectors[i] = "table." + class
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// Navigation boxes and sidebars whose links must not be mistaken for infobox
+// values.
+const navigationSelector = ".navbox, .sidebar"
+
+// albumInfobox returns the infobox matched by the client's selector or the
+// release infobox, whichever comes first.
+func (c *Client) albumInfobox(doc *goquery.Document) *goquery.Selection {
+	return firstInfobox(doc, c.selectors.Infobox+", "+c.releaseSelector())
+}
+
+// mainInfobox returns the infobox of the article matched by the client's
+// selector, skipping sidebars and navboxes which sometimes carry the infobox
+// class too.
+func (c *Client) mainInfobox(doc *goquery.Document) *goquery.Selection {
+	return firstInfobox(doc, c.selectors.Infobox)
+}
+
+// firstInfobox returns the first table matched by selector outside
+// navigation.
+func firstInfobox(doc *goquery.Document, selector string) *goquery.Selection {
+	return doc.Find(selector).
+		FilterFunction(outsideNavigation).
+		First()
+}
+
+func outsideNavigation(i int, s *goquery.Selection) bool {
+	return !s.Is(navigationSelector) && s.ParentsFiltered(navigationSelector).Length() == 0
+}
+
+// WithInfoboxDump makes the client log HTML of the infobox and the release
+// infobox of each album page it scrapes, to help diagnose selectors that
+// don't match.
+func WithInfoboxDump() Option {
+	return func(c *Client) {
+		c.infoboxDump = true
+	}
+}
+
+// dumpInfobox logs HTML of the infobox and release infobox of page at uri.
+func (c *Client) dumpInfobox(uri string, doc *goquery.Document) {
+	var tablesHTML []string
+	tables := c.mainInfobox(doc).AddSelection(doc.Find(c.releaseSelector()).First())
+	for _, node := range tables.Nodes {
+		var buf bytes.Buffer
+		if err := html.Render(&buf, node); err == nil {
+			tablesHTML = append(tablesHTML, buf.String())
+		}
+	}
+	if len(tablesHTML) == 0 {
+		logger.Printf("no infobox in %s", uri)
+		return
+	}
+	logger.Printf("infobox of %s:\n%s", uri, strings.Join(tablesHTML, "\n"))
+}
+
+// infoboxRow returns the infobox value cell labelled with label. The
+// selection is empty if there's no such row.
+func (c *Client) infoboxRow(doc *goquery.Document, label string) *goquery.Selection {
+	return c.mainInfobox(doc).
+		Find("tr").
+		FilterFunction(func(i int, row *goquery.Selection) bool {
+			return strings.TrimSpace(row.Find("th").First().Text()) == label
+		}).
+		First().
+		Find("td").
+		First()
+}
+
+// infoboxRowText returns the whitespace-collapsed text of the infobox value
+// cell labelled with label, or an empty string if there's no such row.
+func (c *Client) infoboxRowText(doc *goquery.Document, label string) string {
+	return strings.Join(strings.Fields(c.infoboxRow(doc, label).Text()), " ")
+}
+
+// infoboxRowValues returns values of the infobox cell labelled with label,
+// see cellValues.
+func (c *Client) infoboxRowValues(doc *goquery.Document, label string) []string {
+	return cellValues(c.infoboxRow(doc, label))
+}
+
+// cellValues returns link texts of table cell. If the cell has no links, its
+// text is split on commas instead.
+func cellValues(cell *goquery.Selection) []string {
+	var result []string
+	cell.Find("a").Each(textFromSelection(&result))
+	if len(result) > 0 {
+		return result
+	}
+	for _, value := range strings.Split(cell.Text(), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+var reLeadSentence = regexp.MustCompile(`^.*?(?:\balbum\b|\bEP\b|\bsingle\b|\. )`)
+
+// scrapeLeadGenres looks for genre phrases of m in the first sentence of the
+// lead paragraph, e.g. "Master of Puppets is a thrash metal album", up to the
+// word "album". Longer phrases win over the ones they contain.
+func scrapeLeadGenres(doc *goquery.Document, m *genreMatcher) []string {
+	var lead string
+	doc.Find("#mw-content-text p").
+		EachWithBreak(func(i int, p *goquery.Selection) bool {
+			lead = strings.Join(strings.Fields(p.Text()), " ")
+			return lead == ""
+		})
+	if sentence := reLeadSentence.FindString(lead); sentence != "" {
+		lead = sentence
+	}
+	return m.match(lead)
+}
+
+// genreMatcher finds genre phrases of a lexicon in text. Patterns are
+// compiled once, when the lexicon is set.
+type genreMatcher struct {
+	genres   []string
+	patterns []*regexp.Regexp
+}
+
+func newGenreMatcher(lexicon []string) *genreMatcher {
+	m := &genreMatcher{genres: lexicon}
+	for _, genre := range lexicon {
+		m.patterns = append(m.patterns, regexp.MustCompile(`\b`+regexp.QuoteMeta(strings.ToLower(genre))+`\b`))
+	}
+	return m
+}
+
+// match returns genre phrases found in text, in order of appearance. Longer
+// phrases win over the ones they contain.
+func (m *genreMatcher) match(text string) []string {
+	text = strings.ToLower(text)
+	var matches []leadMatch
+	for i, re := range m.patterns {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, leadMatch{m.genres[i], loc[0], loc[1]})
+		}
+	}
+	sort.Sort(byStart(matches))
+
+	var result []string
+	for _, m := range matches {
+		contained := false
+		for _, other := range matches {
+			if other.end-other.start > m.end-m.start && other.start <= m.start && m.end <= other.end {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			result = append(result, m.genre)
+		}
+	}
+	return result
+}
+
+type leadMatch struct {
+	genre      string
+	start, end int
+}
+
+type byStart []leadMatch
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Less(i, j int) bool { return s[i].start < s[j].start }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
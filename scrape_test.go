@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
+)
+
+var update = flag.Bool("update", false, "rewrite .golden files with genres scraped from test pages")
+
+// Saved Wikipedia pages, each with genres expected to be scraped from it
+// listed one per line in a .golden file of the same name.
+const pagesDir = "testdata/pages"
+
+// loadPage parses the saved page name.html.
+func loadPage(t testing.TB, name string) *goquery.Document {
+	f, err := os.Open(filepath.Join(pagesDir, name+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// pageNames returns names of saved pages without extension.
+func pageNames(t testing.TB) []string {
+	paths, err := filepath.Glob(filepath.Join(pagesDir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no pages in %s", pagesDir)
+	}
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = strings.TrimSuffix(filepath.Base(path), ".html")
+	}
+	return names
+}
+
+func TestScrapeGenresGolden(t *testing.T) {
+	c := NewClient()
+	for _, name := range pageNames(t) {
+		genres, _ := c.scrapeGenres(loadPage(t, name))
+		var got string
+		for _, g := range genres {
+			got += g + "\n"
+		}
+		golden := filepath.Join(pagesDir, name+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: got genres\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func BenchmarkScrapeGenres(b *testing.B) {
+	c := NewClient()
+	var docs []*goquery.Document
+	for _, name := range pageNames(b) {
+		docs = append(docs, loadPage(b, name))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			c.scrapeGenres(doc)
+		}
+	}
+}
+
+func TestIsGenreArticle(t *testing.T) {
+	tests := []struct {
+		page string
+		want bool
+	}{
+		{"genre-article", true},
+		{"hlist-infobox", false},
+		{"classic-infobox", false},
+		{"navbox", false},
+	}
+	for _, shortDesc := range []bool{false, true} {
+		c := NewClient()
+		if shortDesc {
+			c = NewClient(WithShortDescription())
+		}
+		for _, tt := range tests {
+			if got := c.isGenreArticle(loadPage(t, tt.page)); got != tt.want {
+				t.Errorf("%s, short description %v: got %v, want %v", tt.page, shortDesc, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestWithSelectorsInfoboxRows(t *testing.T) {
+	const page = `<table class="albuminfo">
+		<tr><td class="description">Studio album by <a href="/wiki/Nirvana_(band)">Nirvana</a></td></tr>
+		<tr><th>Genre</th><td><a href="/wiki/Grunge">Grunge</a></td></tr>
+		<tr><th>Released</th><td>September 24, 1991</td></tr>
+		<tr><th>Country</th><td>United States</td></tr>
+		<tr><th>Styles</th><td><a href="/wiki/Noise_pop">Noise pop</a></td></tr>
+	</table>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(WithSelectors(Selectors{Infobox: "table.albuminfo"}), WithStyles())
+	info := c.scrapeAlbumInfo(doc)
+	if want := []string{"Grunge"}; !reflect.DeepEqual(info.Genres, want) {
+		t.Errorf("got genres %q, want %q", info.Genres, want)
+	}
+	if info.Type != "Studio album" {
+		t.Errorf("got type %q, want %q", info.Type, "Studio album")
+	}
+	if info.Released != "September 24, 1991" || info.Year != 1991 {
+		t.Errorf("got released %q in %d, want September 24, 1991", info.Released, info.Year)
+	}
+	if info.Country != "United States" {
+		t.Errorf("got country %q, want %q", info.Country, "United States")
+	}
+	if want := []string{"Noise pop"}; !reflect.DeepEqual(info.Styles, want) {
+		t.Errorf("got styles %q, want %q", info.Styles, want)
+	}
+}
+
+func TestWithInfoboxDump(t *testing.T) {
+	wiki := newFakeWiki(nil, map[string]string{"Nevermind": "hlist-infobox"})
+	defer wiki.Close()
+	defer func(l *log.Logger) { logger = l }(logger)
+	for _, dump := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger = log.New(&buf, "", 0)
+		c := wiki.client()
+		if dump {
+			c = wiki.client(WithInfoboxDump())
+		}
+		if _, err := c.GenresFromURL(wiki.URL + "/wiki/Nevermind"); err != nil {
+			t.Fatal(err)
+		}
+		dumped := strings.Contains(buf.String(), `<table class="infobox vevent haudio">`)
+		if dumped != dump {
+			t.Errorf("WithInfoboxDump %v: got log %q", dump, buf.String())
+		}
+	}
+}
+
+func TestScrapeTitle(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		{"hlist-infobox", "Nevermind"},
+		{"mobile", "In Utero"},
+	}
+	for _, tt := range tests {
+		if got := scrapeTitle(loadPage(t, tt.page)); got != tt.want {
+			t.Errorf("%s: got title %q, want %q", tt.page, got, tt.want)
+		}
+	}
+
+	// Older mobile pages have no #firstHeading.
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<h1 id="section_0">Bleach</h1>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scrapeTitle(doc); got != "Bleach" {
+		t.Errorf("got title %q, want %q", got, "Bleach")
+	}
+}
+
+func TestWithJoinedLinks(t *testing.T) {
+	tests := []struct {
+		page string
+		want []string
+	}{
+		{"fused-links", []string{"Jazz fusion", "jazz-rock"}},
+		{"separate-links", []string{"Jazz", "fusion", "jazz-rock"}},
+	}
+	c := NewClient(WithJoinedLinks())
+	for _, tt := range tests {
+		if got, _ := c.scrapeGenres(loadPage(t, tt.page)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got genres %q, want %q", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestTryScrapePanic(t *testing.T) {
+	got := tryScrape(func() []string {
+		var doc *goquery.Document
+		return []string{doc.Text()}
+	})
+	if got != nil {
+		t.Errorf("got genres %q, want none", got)
+	}
+	if genres, source := NewClient().scrapeGenres(nil); genres != nil || source != "" {
+		t.Errorf("nil document: got genres %q from %q, want none", genres, source)
+	}
+}
+
+func TestGenreMatcher(t *testing.T) {
+	m := newGenreMatcher([]string{"rock", "hard rock", "R&B", "pop"})
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"a Hard rock and R&B album", []string{"hard rock", "R&B"}},
+		{"a rock album with pop songs", []string{"rock", "pop"}},
+		{"a popular rockabilly album", nil},
+	}
+	for _, tt := range tests {
+		if got := m.match(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// SearchStrategy tells how album pages are searched for.
+type SearchStrategy string
+
+// Search strategies.
+const (
+	// SearchOpenSearch matches query as a prefix of article titles.
+	SearchOpenSearch SearchStrategy = "opensearch"
+	// SearchFullText matches query as an exact phrase in article titles,
+	// which is more precise for short and generic album names.
+	SearchFullText SearchStrategy = "fulltext"
+)
+
+// WithSearchStrategy sets how album pages are searched for. Defaults to
+// SearchOpenSearch. Parameters given with WithSearchParams only apply to
+// SearchOpenSearch.
+func WithSearchStrategy(strategy SearchStrategy) Option {
+	return func(c *Client) {
+		c.searchStrategy = strategy
+	}
+}
+
+// searchFullText searches article titles for query as a quoted phrase using
+// the full-text search API.
+func (c *Client) searchFullText(ctx context.Context, query string) (searchResponse, error) {
+	sr := searchResponse{query: query}
+	var qr struct {
+		Query struct {
+			Search []struct {
+				Title   string
+				Snippet string
+			}
+		}
+	}
+	phrase := strings.Replace(query, `"`, "", -1)
+	err := c.queryAPI(ctx, c.baseURL, url.Values{
+		"action":      {"query"},
+		"list":        {"search"},
+		"srsearch":    {`intitle:"` + phrase + `"`},
+		"srnamespace": {"0"},
+		"srlimit":     {"10"},
+	}, &qr)
+	if err != nil {
+		return sr, err
+	}
+	for _, result := range qr.Query.Search {
+		sr.suggestions = append(sr.suggestions, result.Title)
+		sr.snippets = append(sr.snippets, result.Snippet)
+		sr.uris = append(sr.uris, c.articleBaseURL+escapeTitle(result.Title))
+	}
+	return sr, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// WithMinTitleSimilarity makes lookups skip pages whose title is too unlike
+// the album looked up, e.g. a random article found for "Untitled". Similarity
+// ranges from 0 for nothing in common to 1 for titles equal ignoring case,
+// punctuation and disambiguation like "(Nirvana album)". Pages found for the
+// artist alone are exempt. Defaults to 0, accepting any page.
+func WithMinTitleSimilarity(min float64) Option {
+	return func(c *Client) {
+		c.minSimilarity = min
+	}
+}
+
+// titleMatches tells whether page title is similar enough to album.
+func (c *Client) titleMatches(title, album string) bool {
+	if c.minSimilarity <= 0 || album == "" {
+		return true
+	}
+	return titleSimilarity(title, album) >= c.minSimilarity
+}
+
+var reDisambiguation = regexp.MustCompile(`\s*\([^)]*\)$`)
+
+// titleSimilarity compares normalized titles by edit distance relative to
+// the longer one.
+func titleSimilarity(a, b string) float64 {
+	ra := []rune(normalizeTitle(a))
+	rb := []rune(normalizeTitle(b))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// normalizeTitle lower-cases title and drops disambiguation and punctuation.
+func normalizeTitle(title string) string {
+	title = reDisambiguation.ReplaceAllString(title, "")
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// levenshtein returns the number of rune insertions, deletions and
+// substitutions turning a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range a {
+		cur[0] = i + 1
+		for j := range b {
+			cost := 1
+			if a[i] == b[j] {
+				cost = 0
+			}
+			cur[j+1] = min3(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
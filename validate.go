@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Album that is known to have genres in its infobox.
+var canary = artistAlbum{"Nirvana", "Nevermind", "Nirvana - Nevermind"}
+
+// validate runs a canary lookup step by step and reports the outcome of each
+// step to stderr. It returns false if any step fails.
+func (c *Client) validate() bool {
+	start := time.Now()
+	sr, err := c.searchWikipedia(context.Background(), canary.album)
+	if err != nil {
+		errLogger.Error("", fmt.Errorf("search endpoint: %s", err))
+		return false
+	}
+	if len(sr.uris) == 0 {
+		errLogger.Error("", fmt.Errorf("search endpoint: no results for %s", canary.album))
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "search endpoint: ok, %d results in %s\n", len(sr.uris), time.Since(start))
+
+	start = time.Now()
+	info, err := c.LookupAlbum(canary.artist, canary.album)
+	if err != nil {
+		errLogger.Error(canary.both, err)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "canary lookup: ok, %s resolved to %s in %s\n", canary.both, info.URL, time.Since(start))
+	fmt.Fprintf(os.Stderr, "canary genres: %s\n", strings.Join(info.Genres, "; "))
+	return true
+}
@@ -2,93 +2,397 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
-	"runtime"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/PuerkitoBio/goquery"
-	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/franela/goreq"
 	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/shiena/ansicolor"
-	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/ttacon/chalk"
 )
 
 // ErrNoGenres is returned if scraping yields no genres.
 var ErrNoGenres = fmt.Errorf("couldn't find any genres")
 
+// ErrNotFound is returned if Wikipedia responds to a request with HTTP 404,
+// e.g. for an article that is gone. Lookups try the next search variant then.
+var ErrNotFound = fmt.Errorf("not found on Wikipedia")
+
+// ErrLowConfidence is returned if genres were found, but none of them with
+// confidence required by WithMinConfidence.
+var ErrLowConfidence = fmt.Errorf("genres found are below minimum confidence")
+
 var colorStderr = ansicolor.NewAnsiColorWriter(os.Stderr)
 var logger = log.New(colorStderr, "", log.LstdFlags)
 
-// Log requests to Wikipedia.
+// Log requests to Wikipedia and the search variant and result each album
+// resolved to.
 var Verbose = false
 
-const verboseUsage = "print URIs of HTTP requests"
+const verboseUsage = "print URIs of HTTP requests and the search variant and result each album resolved to"
+
+var validate = false
+
+const validateUsage = "check connectivity with a canary lookup and exit"
+
+var sortGenres = false
+
+const sortUsage = "sort genres alphabetically instead of infobox order"
+
+var quiet = false
+
+const quietUsage = "don't print summary statistics after the run"
+
+var inputFmt inputFormat = "foobar2k"
+
+const inputFormatUsage = "`format` of lines read from stdin: foobar2k, plain (ARTIST - ALBUM) or tsv (ARTIST<tab>ALBUM)"
+
+var strict = false
+
+const strictUsage = "fail on stdin lines that can't be parsed instead of skipping them"
+
+var logJSON = false
+
+const logJSONUsage = "print errors to stderr as JSON objects"
+
+var minConfidence = 0.0
+
+const minConfidenceUsage = "reject genres with confidence below this, from 0 (default) to 1"
+
+var outFmt outputFormat = "text"
+
+const outputFormatUsage = "output `format`: text (genres of album on a line), lines (genre per line, albums separated by blank line) or m3u-comments (#EXTGENRE:ALBUM=GENRE,GENRE)"
+
+var stream = false
+
+const streamUsage = "look up stdin lines as they're read and print results right away"
+
+var concurrency = 8
+
+const concurrencyUsage = "maximum number of concurrent lookups with -stream"
+
+var statsMode = ""
+
+const statsUsage = "print additional statistics to stderr: genres (most frequent genres)"
+
+var noArtistFallback = false
+
+const noArtistFallbackUsage = "don't fall back to genres of the artist when the album isn't found"
+
+var mappingOut = ""
+
+const mappingOutUsage = "write how queries were resolved to JSON `file`, ignored with -stream"
+
+var mappingIn = ""
+
+const mappingInUsage = "resolve queries found in JSON `file` written by -mapping-out without searching"
+
+var dumpInfobox = false
+
+const dumpInfoboxUsage = "print HTML of the infobox of each album page to stderr"
+
+var splitSep = ""
+
+const splitUsage = "split each argument on `delimiter` into multiple albums"
+
+var mergePages = 0
+
+const mergeUsage = "merge genres of up to `n` matching pages, e.g. of the album and the artist"
+
+var withTitle = false
+
+const withTitleUsage = "prefix each line of text output with the query and a tab"
+
+var notFoundText = ""
+
+const notFoundTextUsage = "`text` printed in text output for albums without genres, e.g. N/A"
+
+var batchTimeout time.Duration
+
+const batchTimeoutUsage = "give up albums not looked up within this `duration` of the run, e.g. 10m"
+
+var outTemplate = ""
+
+const templateUsage = "print each result with Go `template` instead of -format, e.g. '{{.Album}}: {{join .Genres \", \"}}'"
+
+var resume = ""
+
+const resumeUsage = "record resolved albums to checkpoint `file` and skip ones recorded by an earlier run, ignored with -stream"
+
+var showURLs = false
+
+const showURLsUsage = "print the article URL each album resolves to on stderr as it's looked up, unless -quiet"
+
+var warn = false
+
+const warnUsage = "warn on stderr about likely wrong matches, e.g. a single genre like Music or more than 8 genres"
+
+var skipFile = ""
+
+const skipUsage = "don't look up albums listed in `file`, one per line in -input-format, e.g. ones already tagged"
+
+var noHAudio = false
+
+const noHAudioUsage = "don't scrape genres from the hAudio microformat of album pages"
+
+var noInfobox = false
+
+const noInfoboxUsage = "don't scrape genres from the infobox row of album pages"
+
+var noUmbrella = false
+
+const noUmbrellaUsage = "drop broad genres like Rock music from albums that have more specific ones"
+
+var negativeCachePath = ""
+
+const negativeCacheUsage = "record albums without genres to JSON `file` and skip ones recorded within -negative-ttl"
+
+var negativeTTL = 30 * 24 * time.Hour
+
+const negativeTTLUsage = "how long albums recorded by -negative-cache are skipped"
+
+// Albums known to have no genres, set with -negative-cache.
+var negatives *negativeCache
+
+var genreCase = TitleCase
+
+const caseUsage = "`casing` of genres: title, title-proper, lower or preserve"
 
 func init() {
 	flag.BoolVar(&Verbose, "v", false, verboseUsage)
-
-	goreq.SetConnectTimeout(10 * time.Second)
+	flag.BoolVar(&validate, "validate", false, validateUsage)
+	flag.BoolVar(&sortGenres, "sort", false, sortUsage)
+	flag.Var(&genreCase, "case", caseUsage)
+	flag.BoolVar(&quiet, "quiet", false, quietUsage)
+	flag.Var(&inputFmt, "input-format", inputFormatUsage)
+	flag.BoolVar(&strict, "strict", false, strictUsage)
+	flag.BoolVar(&logJSON, "log-json", false, logJSONUsage)
+	flag.Float64Var(&minConfidence, "min-confidence", 0, minConfidenceUsage)
+	flag.Var(&outFmt, "format", outputFormatUsage)
+	flag.BoolVar(&stream, "stream", false, streamUsage)
+	flag.IntVar(&concurrency, "j", 8, concurrencyUsage)
+	flag.StringVar(&statsMode, "stats", "", statsUsage)
+	flag.BoolVar(&noArtistFallback, "no-artist-fallback", false, noArtistFallbackUsage)
+	flag.StringVar(&mappingOut, "mapping-out", "", mappingOutUsage)
+	flag.StringVar(&mappingIn, "mapping-in", "", mappingInUsage)
+	flag.BoolVar(&dumpInfobox, "dump-infobox", false, dumpInfoboxUsage)
+	flag.StringVar(&splitSep, "split", "", splitUsage)
+	flag.IntVar(&mergePages, "merge", 0, mergeUsage)
+	flag.BoolVar(&withTitle, "with-title", false, withTitleUsage)
+	flag.StringVar(&notFoundText, "not-found-text", "", notFoundTextUsage)
+	flag.DurationVar(&batchTimeout, "batch-timeout", 0, batchTimeoutUsage)
+	flag.StringVar(&outTemplate, "template", "", templateUsage)
+	flag.StringVar(&resume, "resume", "", resumeUsage)
+	flag.BoolVar(&showURLs, "show-urls", false, showURLsUsage)
+	flag.BoolVar(&warn, "warn", false, warnUsage)
+	flag.StringVar(&skipFile, "skip", "", skipUsage)
+	flag.BoolVar(&noHAudio, "no-haudio", false, noHAudioUsage)
+	flag.BoolVar(&noInfobox, "no-infobox", false, noInfoboxUsage)
+	flag.BoolVar(&noUmbrella, "no-umbrella", false, noUmbrellaUsage)
+	flag.StringVar(&negativeCachePath, "negative-cache", "", negativeCacheUsage)
+	flag.DurationVar(&negativeTTL, "negative-ttl", 30*24*time.Hour, negativeTTLUsage)
 }
 
 func usage() {
-	fmt.Fprintln(os.Stderr, `usage: go-wikigenre [-h] [-v] "[ARTIST - ]ALBUM"( "[ARTIST - ]ALBUM")*`)
-	fmt.Fprintln(os.Stderr, `  -v=false: `+verboseUsage)
+	fmt.Fprintln(os.Stderr, `usage: go-wikigenre [-h] [flags] "[ARTIST - ]ALBUM"( "[ARTIST - ]ALBUM")*`)
+	flag.PrintDefaults()
 	os.Exit(2)
 }
 
-// Prevent data races in goreq the hard way.
-// Passing cookiejar to goreq.Request will create a new instance of http.Client,
-// so Do method won't write into CheckRedirect field of goreq.DefaultClient.
-type dummyCookiejar struct{}
-
-func (c dummyCookiejar) SetCookies(u *url.URL, cookies []*http.Cookie) {}
-func (c dummyCookiejar) Cookies(u *url.URL) []*http.Cookie {
-	return nil
-}
-
 func main() {
 	flag.Usage = usage
 	flag.Parse()
 	args := flag.Args()
+	if splitSep != "" {
+		args = splitArgs(args, splitSep)
+	}
+
+	if logJSON {
+		errLogger = newJSONErrorLogger(os.Stderr)
+	}
+	if statsMode != "" && statsMode != "genres" {
+		fmt.Fprintf(os.Stderr, "unknown -stats value %q, want genres\n", statsMode)
+		usage()
+	}
+	printer := newResultPrinter(outFmt, os.Stdout)
+	if outTemplate != "" {
+		var err error
+		printer, err = newTemplatePrinter(os.Stdout, outTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -template: %s\n", err)
+			usage()
+		}
+	}
+	opts := clientOptions()
+	var skips []func(artist, album string) bool
+	if skipFile != "" {
+		skip, err := readSkipList(skipFile, inputParsers[inputFmt])
+		if err != nil {
+			errLogger.Error("", fmt.Errorf("error reading skip list: %s", err))
+			os.Exit(1)
+		}
+		skips = append(skips, skip)
+	}
+	if negativeCachePath != "" {
+		var err error
+		negatives, err = openNegativeCache(negativeCachePath, negativeTTL)
+		if err != nil {
+			errLogger.Error("", fmt.Errorf("error reading negative cache: %s", err))
+			os.Exit(1)
+		}
+		skips = append(skips, negatives.known)
+	}
+	if len(skips) > 0 {
+		opts = append(opts, WithSkip(func(artist, album string) bool {
+			for _, skip := range skips {
+				if skip(artist, album) {
+					return true
+				}
+			}
+			return false
+		}))
+	}
+	client := NewClient(opts...)
+
+	if validate {
+		if !client.validate() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	ctx := context.Background()
+	if batchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, batchTimeout)
+		defer cancel()
+	}
+
+	if stream && len(args) == 0 {
+		code := streamStdin(ctx, client, inputParsers[inputFmt], printer)
+		if !saveNegatives() {
+			code = 1
+		}
+		os.Exit(code)
+	}
 
 	var artistAlbums []artistAlbum
 	if len(args) > 0 {
 		artistAlbums = artistAlbumsFromCLI(args)
 	} else {
 		var err error
-		artistAlbums, err = artistAlbumsFromStdin()
+		artistAlbums, err = artistAlbumsFromStdin(inputParsers[inputFmt])
 		if err != nil {
-			errorln("error reading from stdin: ", err)
+			errLogger.Error("", fmt.Errorf("error reading from stdin: %s", err))
 			os.Exit(1)
 		}
 	}
 
+	var mapping map[string]mappingEntry
+	if mappingIn != "" {
+		var err error
+		mapping, err = readMapping(mappingIn)
+		if err != nil {
+			errLogger.Error("", fmt.Errorf("error reading mapping: %s", err))
+			os.Exit(1)
+		}
+	}
+	done := reportResult
+	if resume != "" {
+		cp, resumed, err := openCheckpoint(resume)
+		if err != nil {
+			errLogger.Error("", fmt.Errorf("error opening checkpoint: %s", err))
+			os.Exit(1)
+		}
+		defer cp.Close()
+		if mapping == nil {
+			mapping = make(map[string]mappingEntry)
+		}
+		for q, e := range resumed {
+			mapping[q] = e
+		}
+		done = func(r BatchResult) {
+			reportResult(r)
+			cp.record(r)
+		}
+	}
+
 	code := 0
-	gs, errs := multipleAlbumGenres(artistAlbums)
-	if errs != nil {
-		for _, err := range errs {
-			errorln(err)
+	start := time.Now()
+	results := client.lookupAlbumsMapped(ctx, artistAlbums, mapping, done)
+	blocked := false
+	for _, r := range results {
+		if r.Err != nil {
+			errLogger.Error(r.Query, r.Err)
+			code = 1
 		}
+		if _, ok := r.Err.(*BlockedError); ok {
+			blocked = true
+		}
+	}
+	if blocked {
+		errLogger.Error("", errBlockedHint)
+	}
+	if !saveNegatives() {
 		code = 1
 	}
-	for _, g := range gs {
-		fmt.Println(strings.Join(g, "; "))
+	if mappingOut != "" {
+		if err := writeMapping(mappingOut, results); err != nil {
+			errLogger.Error("", fmt.Errorf("error writing mapping: %s", err))
+			code = 1
+		}
+	}
+	for _, r := range results {
+		printer.Print(r)
+	}
+	if !quiet {
+		fmt.Fprintln(os.Stderr, summarize(results, client.requestCount(), time.Since(start)))
+	}
+	if statsMode == "genres" {
+		printTopGenres(GenreCounts(results))
 	}
 	os.Exit(code)
 }
 
-func errorln(arg ...interface{}) {
-	fmt.Fprint(colorStderr, chalk.Red)
-	fmt.Fprint(colorStderr, arg...)
-	fmt.Fprint(colorStderr, chalk.Reset, "\n")
+// clientOptions translates command-line flags to client options.
+func clientOptions() []Option {
+	opts := []Option{WithCase(genreCase)}
+	if sortGenres {
+		opts = append(opts, WithSortedGenres())
+	}
+	if noArtistFallback {
+		opts = append(opts, WithoutArtistFallback())
+	}
+	if minConfidence > 0 {
+		opts = append(opts, WithMinConfidence(minConfidence))
+	}
+	if mergePages > 1 {
+		opts = append(opts, WithMergedPages(mergePages))
+	}
+	if noHAudio {
+		opts = append(opts, WithoutHAudio())
+	}
+	if noInfobox {
+		opts = append(opts, WithoutInfobox())
+	}
+	if noUmbrella {
+		opts = append(opts, WithoutUmbrellaGenres())
+	}
+	if dumpInfobox {
+		opts = append(opts, WithInfoboxDump())
+	}
+	return opts
 }
 
 type artistAlbum struct {
@@ -98,21 +402,174 @@ type artistAlbum struct {
 func artistAlbumsFromCLI(args []string) []artistAlbum {
 	var result []artistAlbum
 	for _, arg := range args {
-		parts := strings.SplitN(arg, " - ", 2)
-		var artist, album string
-		switch len(parts) {
-		case 1:
-			artist, album = "", arg
-		case 2:
-			artist, album = parts[0], parts[1]
+		result = append(result, parsePlainItem(arg))
+	}
+	return result
+}
+
+// splitArgs splits each of args on sep, dropping blank parts.
+func splitArgs(args []string, sep string) []string {
+	var result []string
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, sep) {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
 		}
-		result = append(result, artistAlbum{artist, album, arg})
 	}
 	return result
 }
 
-// Read foobar2k items from stdin.
-func artistAlbumsFromStdin() ([]artistAlbum, error) {
+// inputFormat selects how lines read from stdin are parsed.
+type inputFormat string
+
+var inputParsers = map[inputFormat]func(string) artistAlbum{
+	"foobar2k": parseFoobar2kItem,
+	"plain":    parsePlainItem,
+	"tsv":      parseTSVItem,
+}
+
+func (f inputFormat) String() string {
+	return string(f)
+}
+
+// Set implements flag.Value.
+func (f *inputFormat) Set(s string) error {
+	if _, ok := inputParsers[inputFormat(s)]; !ok {
+		return fmt.Errorf("unknown input format %q, want foobar2k, plain or tsv", s)
+	}
+	*f = inputFormat(s)
+	return nil
+}
+
+var errBlockedHint = fmt.Errorf("you appear to be rate-limited or blocked by Wikipedia; slow down or set a proper User-Agent")
+
+// streamStdin looks up items from stdin and prints results as soon as they
+// are available, without reading the whole input first. Lookups still running
+// when ctx is done are given up. It returns exit code.
+func streamStdin(ctx context.Context, client *Client, parse func(string) artistAlbum, printer resultPrinter) int {
+	code := 0
+	start := time.Now()
+	as := make(chan artistAlbum)
+	var readErr error
+	go func() {
+		defer close(as)
+		s := bufio.NewScanner(os.Stdin)
+		for n := 1; s.Scan(); n++ {
+			line := s.Text()
+			// Look for a zero-length read.
+			if len(line) == 0 {
+				break
+			}
+			aa := parse(line)
+			if strict && aa == (artistAlbum{}) {
+				readErr = unparsedLineError(n, line)
+				return
+			}
+			as <- aa
+		}
+		readErr = s.Err()
+	}()
+
+	var stats batchStats
+	counts := make(map[string]int)
+	blocked := false
+	for r := range client.streamAlbums(ctx, as, concurrency) {
+		if r.Err != nil {
+			errLogger.Error(r.Query, r.Err)
+			code = 1
+		}
+		if _, ok := r.Err.(*BlockedError); ok && !blocked {
+			blocked = true
+			errLogger.Error("", errBlockedHint)
+		}
+		reportResult(r)
+		printer.Print(r)
+		stats.add(r)
+		countGenres(counts, r)
+	}
+	if readErr != nil {
+		errLogger.Error("", fmt.Errorf("error reading from stdin: %s", readErr))
+		code = 1
+	}
+	if !quiet {
+		stats.requests = client.requestCount()
+		stats.elapsed = time.Since(start)
+		fmt.Fprintln(os.Stderr, stats)
+	}
+	if statsMode == "genres" {
+		printTopGenres(counts)
+	}
+	return code
+}
+
+// reportResult logs the article URL album of r was resolved to if -show-urls
+// is set, and warnings about the match if -warn is set. It records albums
+// without genres to the negative cache if -negative-cache is set.
+func reportResult(r BatchResult) {
+	if negatives != nil {
+		negatives.record(r)
+	}
+	if r.Info == nil {
+		return
+	}
+	if showURLs && !quiet {
+		errLogger.Resolved(r.Query, r.Info.URL)
+	}
+	if warn {
+		if msg := suspiciousGenres(r.Info.Genres); msg != "" {
+			errLogger.Warning(r.Query, msg)
+		}
+	}
+}
+
+// saveNegatives writes the negative cache if -negative-cache is set. It
+// returns false if that failed.
+func saveNegatives() bool {
+	if negatives == nil {
+		return true
+	}
+	if err := negatives.save(); err != nil {
+		errLogger.Error("", fmt.Errorf("error writing negative cache: %s", err))
+		return false
+	}
+	return true
+}
+
+// Genres too vague to be the only genre of an album.
+var genericGenres = []string{"Music", "Popular music", "Album", "Song", "Various"}
+
+// More genres than an album plausibly has.
+const maxPlausibleGenres = 8
+
+// suspiciousGenres tells why genres suggest that the wrong page was matched,
+// or returns an empty string if they look fine.
+func suspiciousGenres(genres []string) string {
+	if len(genres) == 1 {
+		for _, g := range genericGenres {
+			if strings.EqualFold(genres[0], g) {
+				return fmt.Sprintf("only genre is %q, the page may not be about the album", genres[0])
+			}
+		}
+	}
+	if len(genres) > maxPlausibleGenres {
+		return fmt.Sprintf("%d genres, the page may be about the artist or a genre", len(genres))
+	}
+	return ""
+}
+
+// Number of genres printed by -stats genres.
+const topGenresCount = 20
+
+// printTopGenres prints the most frequent genres to stderr.
+func printTopGenres(counts map[string]int) {
+	for _, gc := range topGenres(counts, topGenresCount) {
+		fmt.Fprintf(os.Stderr, "%d\t%s\n", gc.count, gc.genre)
+	}
+}
+
+// Read items from stdin, parsing each line with parse.
+func artistAlbumsFromStdin(parse func(string) artistAlbum) ([]artistAlbum, error) {
 	s := bufio.NewScanner(os.Stdin)
 	var lines []string
 	for s.Scan() {
@@ -128,13 +585,51 @@ func artistAlbumsFromStdin() ([]artistAlbum, error) {
 	}
 
 	artistAlbums := make([]artistAlbum, len(lines))
+	unparsed := 0
 	for i, line := range lines {
-		artistAlbums[i] = parseFoobar2kItem(line)
+		artistAlbums[i] = parse(line)
+		if strict && artistAlbums[i] == (artistAlbum{}) {
+			errLogger.Error("", unparsedLineError(i+1, line))
+			unparsed++
+		}
+	}
+	if unparsed > 0 {
+		return nil, fmt.Errorf("%d lines couldn't be parsed", unparsed)
 	}
 
 	return artistAlbums, nil
 }
 
+// unparsedLineError reports stdin line number n that can't be parsed with
+// -strict.
+func unparsedLineError(n int, line string) error {
+	return fmt.Errorf("line %d: can't parse %q", n, line)
+}
+
+// readSkipList reads albums from the file at path, parsing each line with
+// parse, and returns a predicate telling whether an album is among them.
+func readSkipList(path string, parse func(string) artistAlbum) (func(artist, album string) bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	type key struct{ artist, album string }
+	albums := make(map[key]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if aa := parse(s.Text()); aa != (artistAlbum{}) {
+			albums[key{aa.artist, aa.album}] = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return func(artist, album string) bool {
+		return albums[key{artist, album}]
+	}, nil
+}
+
 var reFoobar2kItem = regexp.MustCompile(`(?:(.+) - )?\[(.+?)?(?: CD\d+)?(?: #\d+)?\]`)
 
 func parseFoobar2kItem(item string) artistAlbum {
@@ -153,124 +648,531 @@ func parseFoobar2kItem(item string) artistAlbum {
 	return artistAlbum{artist, album, both}
 }
 
-func multipleAlbumGenres(as []artistAlbum) ([][]string, []error) {
-	var wg sync.WaitGroup
-	m := new(sync.Mutex)
-	wg.Add(len(as))
-	uniqueArtistAlbumMap := make(map[artistAlbum][]string)
-	var errs []error
-	for _, aa := range as {
-		q := aa
-		go func() {
-			defer func() {
-				m.Unlock()
-				wg.Done()
-				runtime.Gosched()
-			}()
+// parsePlainItem parses "[ARTIST - ]ALBUM".
+func parsePlainItem(item string) artistAlbum {
+	parts := strings.SplitN(item, " - ", 2)
+	var artist, album string
+	switch len(parts) {
+	case 1:
+		artist, album = "", item
+	case 2:
+		artist, album = parts[0], parts[1]
+	}
+	return artistAlbum{artist, album, item}
+}
 
-			if q == (artistAlbum{}) {
-				return
-			}
+// parseTSVItem parses "ARTIST<tab>ALBUM". A line without tab is an album.
+func parseTSVItem(item string) artistAlbum {
+	parts := strings.SplitN(item, "\t", 2)
+	if len(parts) == 1 {
+		return artistAlbum{"", item, item}
+	}
+	artist, album := parts[0], parts[1]
+	switch {
+	case artist == "":
+		return artistAlbum{"", album, album}
+	case album == "":
+		return artistAlbum{artist, "", artist}
+	}
+	return artistAlbum{artist, album, fmt.Sprintf("%s - %s", artist, album)}
+}
 
-			m.Lock()
-			_, ok := uniqueArtistAlbumMap[q]
-			if ok {
-				// Don't query if query is already in process.
-				return
+// AlbumGenres searches Wikipedia for album page and scrapes genres from it
+// using DefaultClient. At least one of artist or album must be given.
+func AlbumGenres(artist, album string) ([]string, error) {
+	return DefaultClient.AlbumGenres(artist, album)
+}
+
+// AlbumGenres searches Wikipedia for album page and scrapes genres from it. At
+// least one of artist or album must be given.
+//
+// On success the returned slice is never nil nor empty. If no genres are
+// found, the error is ErrNoGenres.
+func (c *Client) AlbumGenres(artist, album string) ([]string, error) {
+	info, err := c.LookupAlbum(artist, album)
+	if err != nil {
+		return nil, err
+	}
+	return info.Genres, nil
+}
+
+// AlbumGenresByTitle scrapes genres from the article titled title using
+// DefaultClient.
+func AlbumGenresByTitle(title string) ([]string, error) {
+	return DefaultClient.AlbumGenresByTitle(title)
+}
+
+// AlbumGenresByTitle scrapes genres from the article titled title, e.g.
+// "Nevermind (album)" resolved by an earlier run, without searching. Like
+// with AlbumGenres, the returned slice is never empty on success, and the
+// error is ErrNoGenres if the article has no genres.
+func (c *Client) AlbumGenresByTitle(title string) ([]string, error) {
+	return c.GenresFromURL(c.articleBaseURL + escapeTitle(title))
+}
+
+// GenresFromURL scrapes genres from album page at uri using DefaultClient.
+func GenresFromURL(uri string) ([]string, error) {
+	return DefaultClient.GenresFromURL(uri)
+}
+
+// GenresFromURL scrapes genres from album page at uri without searching,
+// e.g. for article URLs resolved through Wikidata.
+func (c *Client) GenresFromURL(uri string) ([]string, error) {
+	info, err := c.urlInfo(context.Background(), uri)
+	if err != nil {
+		return nil, err
+	}
+	return info.Genres, nil
+}
+
+// urlInfo scrapes album page at uri, failing if it has no genres.
+func (c *Client) urlInfo(ctx context.Context, uri string) (*AlbumInfo, error) {
+	info, err := c.pageInfo(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Genres) == 0 {
+		return nil, ErrNoGenres
+	}
+	if info.Confidence < c.minConfidence {
+		return nil, ErrLowConfidence
+	}
+	return c.normalizeInfo(info), nil
+}
+
+// AlbumInfo is what could be scraped from an album page. Fields other than
+// Genres are empty if the page doesn't provide them. Slices are never nil, so
+// they are encoded to JSON as [] rather than null.
+type AlbumInfo struct {
+	Title  string
+	URL    string
+	Genres []string
+
+	// Primary is the genre listed first on the page, even if Genres are
+	// sorted, and Secondary are the rest of Genres.
+	Primary   string
+	Secondary []string
+
+	// Source and Confidence tell how trustworthy Genres are.
+	Source     GenreSource
+	Confidence float64
+
+	Type        string // e.g. "Studio album", "EP" or "Single"
+	Description string // only scraped if the client was created with WithShortDescription
+	Released    string
+	Year        int // year of release, 0 if unknown
+	Recorded    string
+	Studio      string
+	Country     string
+	CoverURL    string // of the infobox image, empty if there's none
+
+	// Styles are finer-grained than genres and only scraped if the client
+	// was created with WithStyles.
+	Styles []string
+
+	// Language is the code of the Wikipedia language the genres come from if
+	// they were found with WithFallbackLanguages, otherwise it's empty.
+	// Untranslated are genres left in that language for lack of an article in
+	// the client's language.
+	Language     string
+	Untranslated []string
+
+	// Languages are codes of Wikipedia languages that contributed genres if
+	// the client was created with WithMergedLanguages, otherwise it's empty.
+	Languages []string
+
+	// Redirects are other titles the article is known by. They're only
+	// fetched if the client was created with WithRedirects.
+	Redirects []string
+
+	// GenreLinks identify articles linked from Genres. They're only resolved
+	// if the client was created with WithGenreIDs, otherwise it's empty.
+	GenreLinks []GenreLink
+
+	linkTargets map[string]string // link texts to article titles
+
+	variant int // index of the search variant the page was found by
+	rank    int // position of the page in search results, from 1
+}
+
+// LookupAlbum searches Wikipedia for album page and scrapes genres and other
+// metadata from it using DefaultClient.
+func LookupAlbum(artist, album string) (*AlbumInfo, error) {
+	return DefaultClient.LookupAlbum(artist, album)
+}
+
+// LookupAlbum is like AlbumGenres but returns everything scraped from the
+// album page.
+func (c *Client) LookupAlbum(artist, album string) (*AlbumInfo, error) {
+	return c.lookupAlbum(context.Background(), artist, album, 0)
+}
+
+// LookupAlbumContext is like LookupAlbum but gives up when ctx is done.
+func (c *Client) LookupAlbumContext(ctx context.Context, artist, album string) (*AlbumInfo, error) {
+	return c.lookupAlbum(ctx, artist, album, 0)
+}
+
+// AlbumGenresYear is like AlbumGenres but prefers the edition of the album
+// released in year, using DefaultClient.
+func AlbumGenresYear(artist, album string, year int) ([]string, error) {
+	return DefaultClient.AlbumGenresYear(artist, album, year)
+}
+
+// AlbumGenresYear is like AlbumGenres but prefers the edition of the album
+// released in year. The year is a hint, not a filter: if no page with genres
+// matches the year, the first page with genres is used.
+func (c *Client) AlbumGenresYear(artist, album string, year int) ([]string, error) {
+	info, err := c.lookupAlbum(context.Background(), artist, album, year)
+	if err != nil {
+		return nil, err
+	}
+	return info.Genres, nil
+}
+
+// lookupAlbum tries search variants until it finds a page with genres
+// released in year, or any page with genres if year is 0. A variant failing
+// with an HTTP error other than a fatal one doesn't stop the rest, the error
+// is only returned if no variant has genres.
+func (c *Client) lookupAlbum(ctx context.Context, artist, album string, year int) (*AlbumInfo, error) {
+	variants := c.searchVariants(artist, album, year)
+	if c.maxVariants > 0 && len(variants) > c.maxVariants {
+		variants = variants[:c.maxVariants]
+	}
+	// Pages found for the artist alone aren't compared to the album title.
+	titles := make([]string, len(variants))
+	for i, variant := range variants {
+		if variant != artist {
+			titles[i] = album
+		}
+	}
+	variantInfo := func(i int) (*AlbumInfo, error) {
+		return c.albumInfo(ctx, variants[i], titles[i])
+	}
+	if c.parallelVariants {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		variantInfo = c.resolveVariants(ctx, variants, titles)
+	}
+
+	var primary, found *AlbumInfo
+	var merged []*AlbumInfo
+	var serverErr error
+	lowConfidence := false
+	for i := range variants {
+		info, err := variantInfo(i)
+		if err == ErrNotFound {
+			continue
+		}
+		if e, ok := err.(*HTTPError); ok && !e.Fatal() {
+			// Other variants may still be served fine.
+			serverErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			continue
+		}
+		info.variant = i
+		if primary == nil {
+			primary = info
+		}
+		if len(info.Genres) == 0 {
+			continue
+		}
+		if info.Confidence < c.minConfidence {
+			lowConfidence = true
+			continue
+		}
+		if c.mergePages > 1 {
+			if !containsPage(merged, info.URL) {
+				merged = append(merged, info)
 			}
-			uniqueArtistAlbumMap[q] = nil
-			m.Unlock()
+			if len(merged) == c.mergePages {
+				break
+			}
+			continue
+		}
+		if len(c.preferTypes) > 0 {
+			if found == nil || c.typeRank(info, year) < c.typeRank(found, year) {
+				found = info
+			}
+			continue
+		}
+		if found == nil {
+			found = info
+		}
+		if year == 0 || info.Year == year {
+			found = info
+			break
+		}
+	}
+	if len(merged) > 0 {
+		found = merged[0]
+		for _, info := range merged[1:] {
+			found.Genres = append(found.Genres, info.Genres...)
+			for text, title := range info.linkTargets {
+				if _, ok := found.linkTargets[text]; !ok {
+					found.linkTargets[text] = title
+				}
+			}
+		}
+	}
+	if len(c.mergedLanguages) > 0 {
+		target := found
+		if target == nil {
+			target = primary
+		}
+		if target != nil {
+			c.mergeLanguages(ctx, target)
+			if len(target.Genres) > 0 && target.Confidence >= c.minConfidence {
+				found = target
+			}
+		}
+	}
 
-			gs, err := AlbumGenres(q.artist, q.album)
-			m.Lock()
+	if found == nil {
+		if primary != nil && len(c.fallbackLanguages) > 0 {
+			info, err := c.crossWikiInfo(ctx, primary)
 			if err != nil {
-				errs = append(errs, fmt.Errorf("error finding genres for %s: %s", q.both, err))
+				return nil, err
 			}
-			uniqueArtistAlbumMap[q] = gs
-		}()
+			if info != nil && info.Confidence >= c.minConfidence {
+				return c.normalizeInfo(info), nil
+			}
+		}
+		if c.discographyTables && artist != "" && album != "" {
+			info, err := c.discographyInfo(ctx, artist, album)
+			if err != nil {
+				return nil, err
+			}
+			if info != nil && info.Confidence >= c.minConfidence {
+				return c.normalizeInfo(info), nil
+			}
+		}
+		if lowConfidence {
+			return nil, ErrLowConfidence
+		}
+		if serverErr != nil {
+			return nil, serverErr
+		}
+		return nil, ErrNoGenres
 	}
-	wg.Wait()
 
-	var result [][]string
-	for _, aa := range as {
-		result = append(result, uniqueArtistAlbumMap[aa])
+	if Verbose {
+		logger.Printf("%s: genres from variant %d of %d %q, search result %d",
+			albumKey(artist, album), found.variant+1, len(variants), variants[found.variant], found.rank)
 	}
-	return result, errs
-}
-
-// AlbumGenres searches Wikipedia for album page and scrapes genres from it. At
-// least one of artist or album must be given.
-func AlbumGenres(artist, album string) ([]string, error) {
-	for _, variant := range searchVariants(artist, album) {
-		gs, err := albumGenres(variant)
+	if c.redirects {
+		var err error
+		found.Redirects, err = c.redirectTitles(ctx, articleTitle(found.URL))
 		if err != nil {
 			return nil, err
 		}
-		if len(gs) > 0 {
-			return gs, nil
+	}
+	if c.genreIDs {
+		var err error
+		found.GenreLinks, err = c.genreLinks(ctx, found)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.normalizeInfo(found), nil
+}
+
+// typeRank ranks info by its release type in order of preference, lower is
+// better. Pages released in other year than the given one rank last.
+func (c *Client) typeRank(info *AlbumInfo, year int) int {
+	rank := len(c.preferTypes)
+	for i, t := range c.preferTypes {
+		if strings.EqualFold(info.Type, t) {
+			rank = i
+			break
+		}
+	}
+	if year != 0 && info.Year != year {
+		rank += len(c.preferTypes) + 1
+	}
+	return rank
+}
+
+// containsPage tells whether one of infos was scraped from uri.
+func containsPage(infos []*AlbumInfo, uri string) bool {
+	for _, info := range infos {
+		if info.URL == uri {
+			return true
 		}
 	}
-	return nil, ErrNoGenres
+	return false
+}
+
+// resolveVariants looks up all variants concurrently, comparing pages found
+// to the corresponding album titles like albumInfo. The returned function
+// waits for the page info of i-th variant, so that variants are still
+// considered in order of priority. Lookups still running are abandoned when
+// ctx is cancelled.
+func (c *Client) resolveVariants(ctx context.Context, variants, titles []string) func(i int) (*AlbumInfo, error) {
+	type result struct {
+		info *AlbumInfo
+		err  error
+	}
+	results := make([]chan result, len(variants))
+	for i, variant := range variants {
+		results[i] = make(chan result, 1)
+		go func(i int, variant string) {
+			defer func() {
+				if p := recover(); p != nil {
+					results[i] <- result{err: fmt.Errorf("panic: %v", p)}
+				}
+			}()
+			info, err := c.albumInfo(ctx, variant, titles[i])
+			results[i] <- result{info, err}
+		}(i, variant)
+	}
+	return func(i int) (*AlbumInfo, error) {
+		r := <-results[i]
+		return r.info, r.err
+	}
 }
 
-func searchVariants(artist, album string) []string {
+func (c *Client) searchVariants(artist, album string, year int) []string {
 	var variants []string
-	if artist != "" && album != "" {
+	kind := compilationKindOf(artist)
+	if artist != "" && album != "" && kind == notCompilation {
 		variants = append(variants, fmt.Sprintf("%s (%s album)", album, artist))
 	}
+	if album != "" && year > 0 {
+		variants = append(variants, fmt.Sprintf("%s (%d album)", album, year))
+	}
 	if album != "" {
+		if kind == soundtrack {
+			variants = append(variants, fmt.Sprintf("%s (soundtrack)", album))
+		}
 		variants = append(variants, fmt.Sprintf("%s (album)", album))
 		variants = append(variants, album)
 	}
-	if artist != "" {
+	if artist != "" && kind == notCompilation && (album == "" || c.artistFallback) {
 		variants = append(variants, artist)
 	}
 	return variants
 }
 
-func albumGenres(query string) ([]string, error) {
-	searchResp, err := searchWikipedia(query)
+type compilationKind int
+
+const (
+	notCompilation compilationKind = iota
+	variousArtists
+	soundtrack
+)
+
+var (
+	reVariousArtists = regexp.MustCompile(`(?i)^(various|various artists|va|v\.a\.)$`)
+	reSoundtrack     = regexp.MustCompile(`(?i)^(ost|o\.s\.t\.|soundtrack|original (motion picture )?soundtrack)$`)
+)
+
+// compilationKindOf tells whether artist is a marker of a compilation album
+// rather than a real artist name. Such artists are useless in search queries.
+func compilationKindOf(artist string) compilationKind {
+	artist = strings.TrimSpace(artist)
+	switch {
+	case reVariousArtists.MatchString(artist):
+		return variousArtists
+	case reSoundtrack.MatchString(artist):
+		return soundtrack
+	}
+	return notCompilation
+}
+
+// albumInfo scrapes pages found for query. Pages whose title is too unlike
+// album are skipped, see WithMinTitleSimilarity.
+func (c *Client) albumInfo(ctx context.Context, query, album string) (*AlbumInfo, error) {
+	searchResp, err := c.searchWikipedia(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	// Bail if nothing's found.
-	if len(searchResp.uris) == 0 {
-		return nil, nil
+	uris := searchResp.uris
+	if len(uris) > c.maxCandidates {
+		uris = uris[:c.maxCandidates]
 	}
 
-	uri := searchResp.uris[0] // TODO: check other URIs as well
-	resp, err := wikipediaPage(uri)
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	// Prefer the first page with genres. A page that fails to load doesn't
+	// spoil the others, the error is only returned if all of them fail.
+	var first *AlbumInfo
+	for i, uri := range uris {
+		var info *AlbumInfo
+		info, err = c.pageInfo(ctx, c.articleURL(uri))
+		if isFatal(err) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		info.rank = i + 1
+		if !c.titleMatches(info.Title, album) {
+			continue
+		}
+		if len(info.Genres) > 0 {
+			return info, nil
+		}
+		if first == nil {
+			first = info
+		}
 	}
+	if first != nil {
+		return first, nil
+	}
+	return nil, err
+}
 
-	doc, err := goquery.NewDocumentFromResponse(resp.Response)
+// pageInfo scrapes album page at uri.
+func (c *Client) pageInfo(ctx context.Context, uri string) (*AlbumInfo, error) {
+	if c.scrapeStrategy == ScrapeWikitext {
+		return c.wikitextInfo(ctx, uri)
+	}
+	doc, err := c.fetchDocument(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
-	return scrapeGenres(doc), nil
+	if c.infoboxDump {
+		c.dumpInfobox(uri, doc)
+	}
+	info := c.scrapeAlbumInfo(doc)
+	info.URL = uri
+	if c.dbpedia && info.Confidence < SourceDBpedia.Confidence() {
+		genres, err := c.dbpediaGenres(ctx, articleTitle(uri))
+		if err == nil && len(genres) > 0 {
+			info.Genres = genres
+			info.Source = SourceDBpedia
+			info.Confidence = SourceDBpedia.Confidence()
+		}
+	}
+	c.metrics.Observe("genres", float64(len(info.Genres)))
+	return info, nil
 }
 
-func searchWikipedia(query string) (searchResponse, error) {
+func (c *Client) searchWikipedia(ctx context.Context, query string) (searchResponse, error) {
+	defer c.observeSince("latency.search", time.Now())
+	if c.searchStrategy == SearchFullText {
+		return c.searchFullText(ctx, query)
+	}
+
 	var sr searchResponse
 
-	resp, err := goreq.Request{
-		Uri: "https://en.wikipedia.org/w/api.php",
-		QueryString: url.Values{
-			"action": {"opensearch"},
-			"search": {query},
-		},
-		UserAgent: "Wikigenre",
-		CookieJar: dummyCookiejar{},
-	}.Do()
+	params := url.Values{
+		"action": {"opensearch"},
+		"search": {query},
+	}
+	for name, values := range c.searchParams {
+		params[name] = values
+	}
+	resp, err := c.get(ctx, c.baseURL, params)
 	if err != nil {
 		return sr, err
 	}
+	defer resp.Body.Close()
 	if !isResponseOK(resp) {
-		return sr, fmt.Errorf("search on Wikipedia failed, HTTP status %s", resp.Status)
-	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+		return sr, statusError(c.baseURL, resp)
 	}
 
 	dec := json.NewDecoder(resp.Body)
@@ -281,10 +1183,80 @@ func searchWikipedia(query string) (searchResponse, error) {
 }
 
 // isResponseOK returns false if response code is between 400 and 599.
-func isResponseOK(r *goreq.Response) bool {
+func isResponseOK(r *http.Response) bool {
 	return !(400 <= r.StatusCode && r.StatusCode < 600)
 }
 
+// HTTPError is returned if Wikipedia responds with an error status other
+// than 404, unless it's a BlockedError.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("request to %s failed, HTTP status %s", e.URL, e.Status)
+}
+
+// Fatal tells whether the request was refused as unauthorized or rate
+// limited, so that sending more requests is pointless until backing off.
+func (e *HTTPError) Fatal() bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// BlockedError is returned if Wikipedia refuses to serve requests with HTTP
+// 403 or 429. It usually means that the client must slow down or set a proper
+// User-Agent. Other error responses aren't blocks, even if they mention
+// blocking.
+type BlockedError struct {
+	URL    string
+	Status string
+	Notice string // excerpt of the response mentioning the block, if any
+}
+
+func (e *BlockedError) Error() string {
+	if e.Notice == "" {
+		return fmt.Sprintf("Wikipedia refused request to %s, HTTP status %s", e.URL, e.Status)
+	}
+	return fmt.Sprintf("Wikipedia refused request to %s, HTTP status %s: %s", e.URL, e.Status, e.Notice)
+}
+
+var reBlockNotice = regexp.MustCompile(`(?i)[^.<>]*\b(blocked|user-agent|robot policy|too many requests|rate limit)[^.<>]*`)
+
+// Maximum number of bytes of error response searched for a block notice.
+const maxNoticeBytes = 64 << 10
+
+// statusError returns the error for response r with an error status to a
+// request to uri. It may read from the body of r. uri is given explicitly
+// because transports don't have to set r.Request.
+func statusError(uri string, r *http.Response) error {
+	if r.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if r.StatusCode == http.StatusForbidden || r.StatusCode == http.StatusTooManyRequests {
+		body, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxNoticeBytes))
+		notice := strings.TrimSpace(reBlockNotice.FindString(string(body)))
+		return &BlockedError{uri, r.Status, notice}
+	}
+	return &HTTPError{uri, r.StatusCode, r.Status}
+}
+
+// isFatal tells whether err means that lookups must stop right away.
+func isFatal(err error) bool {
+	switch e := err.(type) {
+	case *HTTPError:
+		return e.Fatal()
+	case *BlockedError:
+		return true
+	}
+	return false
+}
+
 type searchResponse struct {
 	query       string
 	suggestions []string
@@ -302,6 +1274,9 @@ func (sr *searchResponse) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return err
 	}
+	if len(jsonResp) < 4 {
+		return fmt.Errorf("unexpected opensearch response of %d elements, want 4", len(jsonResp))
+	}
 
 	query, ok := jsonResp[0].(string)
 	if !ok {
@@ -320,10 +1295,20 @@ func (sr *searchResponse) UnmarshalJSON(data []byte) error {
 		return assertError(jsonResp[3])
 	}
 
+	// Pair suggestions with URIs by index, ignoring unpaired ones. Snippets
+	// are often omitted altogether.
+	n := len(suggestions)
+	if len(uris) < n {
+		n = len(uris)
+	}
+	for len(snippets) < n {
+		snippets = append(snippets, "")
+	}
+
 	sr.query = query
-	sr.suggestions = suggestions
-	sr.snippets = snippets
-	sr.uris = uris
+	sr.suggestions = suggestions[:n]
+	sr.snippets = snippets[:n]
+	sr.uris = uris[:n]
 	return nil
 }
 
@@ -342,50 +1327,99 @@ func interfaceToStringSlice(obj interface{}) ([]string, bool) {
 	return result, true
 }
 
-func wikipediaPage(uri string) (*goreq.Response, error) {
-	if Verbose {
-		logger.Println(uri)
+// fetchDocument downloads and parses Wikipedia page. Network errors, including
+// ones interrupting the body midway, are retried according to the client's
+// retry policy.
+func (c *Client) fetchDocument(ctx context.Context, uri string) (*goquery.Document, error) {
+	defer c.observeSince("latency.page", time.Now())
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			c.metrics.Increment("retries")
+			select {
+			case <-time.After(c.retryWait(attempt)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var body []byte
+		body, err = c.readPage(ctx, uri)
+		if err == nil {
+			return goquery.NewDocumentFromReader(bytes.NewReader(body))
+		}
+		if !isTemporary(err) {
+			return nil, err
+		}
+		if c.retryBudget != nil && attempt < c.retries && !c.retryBudget.take() {
+			return nil, err
+		}
 	}
-	resp, err := goreq.Request{
-		Uri:       uri,
-		CookieJar: dummyCookiejar{},
-	}.Do()
+	return nil, err
+}
+
+// readPage reads the whole page body so that a dropped connection surfaces as
+// an error instead of a truncated document.
+func (c *Client) readPage(ctx context.Context, uri string) ([]byte, error) {
+	resp, err := c.wikipediaPage(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
-	if !isResponseOK(resp) {
-		return nil, fmt.Errorf("failed to open Wikipedia page %s, HTTP status %s", uri, resp.Status)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !isHTML(ct) {
+		return nil, fmt.Errorf("Wikipedia page %s is not HTML but %s", uri, ct)
 	}
-	return resp, nil
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.metrics.Increment("errors.body")
+		return nil, &bodyError{uri, err}
+	}
+	return body, nil
 }
 
-func scrapeGenres(doc *goquery.Document) []string {
-	var result []string
-	doc.Find("table.haudio td.category a").
-		Each(textFromSelection(&result))
-	if len(result) > 0 {
-		return result
-	}
-	doc.Find("table.infobox th>a").
-		FilterFunction(func(i int, link *goquery.Selection) bool { return link.Text() == "Genre" }).
-		Parent().
-		Parent().
-		Find("td a").
-		Each(textFromSelection(&result))
-	return result
+// isHTML tells whether contentType is HTML. Missing content type is given the
+// benefit of the doubt.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
 }
 
-func textFromSelection(result *[]string) func(int, *goquery.Selection) {
-	return func(i int, link *goquery.Selection) {
-		*result = append(*result, title(link.Text()))
+// bodyError is returned if reading response body fails.
+type bodyError struct {
+	uri string
+	err error
+}
+
+func (e *bodyError) Error() string {
+	return fmt.Sprintf("failed to read Wikipedia page %s: %s", e.uri, e.err)
+}
+
+// isTemporary tells whether request failed due to network and is worth
+// retrying, as opposed to e.g. an HTTP error status.
+func isTemporary(err error) bool {
+	switch err.(type) {
+	case *bodyError, *url.Error:
+		return true
 	}
+	return false
 }
 
-// Title upper-cases only the first letter of each word.
-func title(s string) string {
-	var parts []string
-	for _, part := range strings.Split(s, " ") {
-		parts = append(parts, strings.ToUpper(part[0:1])+part[1:])
+func (c *Client) wikipediaPage(ctx context.Context, uri string) (*http.Response, error) {
+	if Verbose {
+		logger.Println(uri)
+	}
+	resp, err := c.get(ctx, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !isResponseOK(resp) {
+		defer resp.Body.Close()
+		return nil, statusError(uri, resp)
 	}
-	return strings.Join(parts, " ")
+	return resp, nil
 }
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Perlence/go-wikigenre/Godeps/_workspace/src/github.com/ttacon/chalk"
+)
+
+func TestCompilationKindOf(t *testing.T) {
+	tests := []struct {
+		artist string
+		want   compilationKind
+	}{
+		{"Various Artists", variousArtists},
+		{"various artists", variousArtists},
+		{" Various Artists ", variousArtists},
+		{"Various", variousArtists},
+		{"VA", variousArtists},
+		{"V.A.", variousArtists},
+		{"OST", soundtrack},
+		{"Original Motion Picture Soundtrack", soundtrack},
+		{"Nirvana", notCompilation},
+		{"Various Artists Orchestra", notCompilation},
+		{"", notCompilation},
+	}
+	for _, tt := range tests {
+		if got := compilationKindOf(tt.artist); got != tt.want {
+			t.Errorf("compilationKindOf(%q) = %v, want %v", tt.artist, got, tt.want)
+		}
+	}
+}
+
+func TestSearchVariants(t *testing.T) {
+	tests := []struct {
+		artist, album string
+		want          []string
+	}{
+		{"Nirvana", "Nevermind", []string{"Nevermind (Nirvana album)", "Nevermind (album)", "Nevermind", "Nirvana"}},
+		{"Various Artists", "Pulp Fiction", []string{"Pulp Fiction (album)", "Pulp Fiction"}},
+		{"VA", "Pulp Fiction", []string{"Pulp Fiction (album)", "Pulp Fiction"}},
+		{"OST", "Pulp Fiction", []string{"Pulp Fiction (soundtrack)", "Pulp Fiction (album)", "Pulp Fiction"}},
+		{"Various Artists", "", nil},
+	}
+	c := NewClient()
+	for _, tt := range tests {
+		got := c.searchVariants(tt.artist, tt.album, 0)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchVariants(%q, %q) = %q, want %q", tt.artist, tt.album, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkSearchResponseUnmarshalJSON(b *testing.B) {
+	data, err := ioutil.ReadFile("testdata/opensearch.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var sr searchResponse
+		if err := sr.UnmarshalJSON(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// truncatingServer serves the saved page name, cutting the body short and
+// dropping the connection the first truncated times it's requested.
+func truncatingServer(t *testing.T, name string, truncated int32) (*httptest.Server, *int32) {
+	page, err := ioutil.ReadFile(pagesDir + "/" + name + ".html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > truncated {
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.Write(page)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n", len(page))
+		conn.Write(page[:len(page)/2])
+	}))
+	return srv, &requests
+}
+
+func TestFetchDocumentRetriesTruncatedBody(t *testing.T) {
+	srv, requests := truncatingServer(t, "hlist-infobox", 1)
+	defer srv.Close()
+	c := NewClient(WithRetries(2, time.Millisecond))
+	doc, err := c.fetchDocument(context.Background(), srv.URL+"/wiki/Nevermind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	genres, _ := c.scrapeGenres(doc)
+	if want := []string{"Grunge", "alternative rock"}; !reflect.DeepEqual(genres, want) {
+		t.Errorf("got genres %q, want %q", genres, want)
+	}
+}
+
+func TestFetchDocumentTruncatedBodyRetriesExhausted(t *testing.T) {
+	srv, requests := truncatingServer(t, "hlist-infobox", 3)
+	defer srv.Close()
+	c := NewClient(WithRetries(2, time.Millisecond))
+	_, err := c.fetchDocument(context.Background(), srv.URL+"/wiki/Nevermind")
+	if _, ok := err.(*bodyError); !ok {
+		t.Errorf("got error %v, want a bodyError", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
+
+func TestFetchDocumentJSONErrorBody(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"error":{"code":"maxlag","info":"Waiting for a database server: 5 seconds lagged."}}`)
+	}))
+	defer srv.Close()
+	c := NewClient(WithRetries(2, time.Millisecond))
+	doc, err := c.fetchDocument(context.Background(), srv.URL+"/wiki/Nevermind")
+	if err == nil {
+		t.Fatalf("got document %v, want error", doc)
+	}
+	if !strings.Contains(err.Error(), "not HTML but application/json") {
+		t.Errorf("got error %q, want it to name the content type", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+// fakeWiki serves opensearch results and saved pages the way Wikipedia does.
+type fakeWiki struct {
+	*httptest.Server
+
+	results  map[string][]string // titles found by search query
+	pages    map[string]string   // names of saved pages by title
+	requests int32
+
+	mu       sync.Mutex
+	statuses map[string]int // statuses served instead of pages by title
+}
+
+func newFakeWiki(results map[string][]string, pages map[string]string) *fakeWiki {
+	w := &fakeWiki{results: results, pages: pages, statuses: make(map[string]int)}
+	w.Server = httptest.NewServer(w)
+	return w
+}
+
+func (w *fakeWiki) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&w.requests, 1)
+	if r.URL.Path == "/w/api.php" {
+		query := r.URL.Query().Get("search")
+		titles := append([]string{}, w.results[query]...)
+		uris := make([]string, len(titles))
+		for i, title := range titles {
+			uris[i] = w.URL + "/wiki/" + escapeTitle(title)
+		}
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(rw).Encode([]interface{}{query, titles, make([]string, len(titles)), uris})
+		return
+	}
+	title := articleTitle(r.URL.String())
+	w.mu.Lock()
+	status, ok := w.statuses[title]
+	w.mu.Unlock()
+	if ok {
+		http.Error(rw, http.StatusText(status), status)
+		return
+	}
+	name, ok := w.pages[title]
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	http.ServeFile(rw, r, pagesDir+"/"+name+".html")
+}
+
+// setStatus makes the wiki respond to requests for the page title with HTTP
+// status.
+func (w *fakeWiki) setStatus(title string, status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.statuses[title] = status
+}
+
+// client returns a client searching and fetching pages from the fake wiki.
+func (w *fakeWiki) client(opts ...Option) *Client {
+	opts = append([]Option{WithBaseURL(w.URL + "/w/api.php"), WithArticleBaseURL(w.URL + "/wiki/")}, opts...)
+	return NewClient(opts...)
+}
+
+func (w *fakeWiki) requestCount() int {
+	return int(atomic.LoadInt32(&w.requests))
+}
+
+func TestSearchResponseTruncated(t *testing.T) {
+	for _, payload := range []string{
+		`[]`,
+		`["Nevermind"]`,
+		`["Nevermind",["Nevermind"],[""]]`,
+	} {
+		var sr searchResponse
+		err := json.Unmarshal([]byte(payload), &sr)
+		if err == nil || !strings.Contains(err.Error(), "want 4") {
+			t.Errorf("%s: got error %v, want one about the number of elements", payload, err)
+		}
+	}
+}
+
+func TestSearchResponseMismatchedLengths(t *testing.T) {
+	tests := []struct {
+		payload           string
+		suggestions, uris []string
+	}{
+		{
+			`["Nevermind",["Nevermind","Nevermind (video game)"],[],["https://en.wikipedia.org/wiki/Nevermind"]]`,
+			[]string{"Nevermind"},
+			[]string{"https://en.wikipedia.org/wiki/Nevermind"},
+		},
+		{
+			`["Nevermind",["Nevermind"],[""],["https://en.wikipedia.org/wiki/Nevermind","https://en.wikipedia.org/wiki/Nevermind_(video_game)"]]`,
+			[]string{"Nevermind"},
+			[]string{"https://en.wikipedia.org/wiki/Nevermind"},
+		},
+		{
+			`["Nevermind",["Nevermind","Nevermind (video game)"],[],[]]`,
+			[]string{},
+			[]string{},
+		},
+	}
+	for _, tt := range tests {
+		var sr searchResponse
+		if err := json.Unmarshal([]byte(tt.payload), &sr); err != nil {
+			t.Errorf("%s: %s", tt.payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(sr.suggestions, tt.suggestions) || !reflect.DeepEqual(sr.uris, tt.uris) {
+			t.Errorf("%s: got suggestions %q and URIs %q, want %q and %q", tt.payload, sr.suggestions, sr.uris, tt.suggestions, tt.uris)
+		}
+		if len(sr.snippets) != len(sr.uris) {
+			t.Errorf("%s: got %d snippets for %d URIs", tt.payload, len(sr.snippets), len(sr.uris))
+		}
+	}
+}
+
+func TestAlbumInfoSkipsFailedCandidate(t *testing.T) {
+	wiki := newFakeWiki(
+		map[string][]string{"Nevermind (Nirvana album)": {"Nevermind", "Nevermind (Nirvana album)"}},
+		map[string]string{"Nevermind (Nirvana album)": "hlist-infobox"},
+	)
+	defer wiki.Close()
+	wiki.setStatus("Nevermind", http.StatusInternalServerError)
+	c := wiki.client(WithCandidates(2))
+
+	info, err := c.albumInfo(context.Background(), "Nevermind (Nirvana album)", "Nevermind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Grunge", "alternative rock"}; !reflect.DeepEqual(info.Genres, want) {
+		t.Errorf("got genres %q, want %q", info.Genres, want)
+	}
+	if info.rank != 2 {
+		t.Errorf("got search result %d, want 2", info.rank)
+	}
+
+	wiki.setStatus("Nevermind (Nirvana album)", http.StatusInternalServerError)
+	info, err = c.albumInfo(context.Background(), "Nevermind (Nirvana album)", "Nevermind")
+	if e, ok := err.(*HTTPError); !ok || e.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got info %v and error %v, want HTTP 500 error", info, err)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   string // type of error
+		fatal  bool
+	}{
+		{http.StatusNotFound, "", "ErrNotFound", false},
+		{http.StatusBadRequest, "", "*main.HTTPError", false},
+		{http.StatusBadRequest, "<p>Your IP address has been blocked.</p>", "*main.HTTPError", false},
+		{http.StatusBadRequest, "<p>Invalid User-Agent header, requests from it are blocked.</p>", "*main.HTTPError", false},
+		{http.StatusConflict, "<p>Edit conflict: the page is blocked from editing.</p>", "*main.HTTPError", false},
+		{http.StatusUnauthorized, "", "*main.HTTPError", true},
+		{http.StatusForbidden, "", "*main.BlockedError", true},
+		{http.StatusForbidden, "<p>Please set a user-agent and respect our robot policy.</p>", "*main.BlockedError", true},
+		{http.StatusTooManyRequests, "", "*main.BlockedError", true},
+		{http.StatusInternalServerError, "", "*main.HTTPError", false},
+		{http.StatusServiceUnavailable, "<p>Too many requests.</p>", "*main.HTTPError", false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Status:     fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)),
+			Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+		}
+		err := statusError("https://en.wikipedia.org/wiki/Nevermind", resp)
+		got := fmt.Sprintf("%T", err)
+		if err == ErrNotFound {
+			got = "ErrNotFound"
+		}
+		if got != tt.want {
+			t.Errorf("HTTP %d %q: got %s, want %s", tt.status, tt.body, got, tt.want)
+		}
+		if isFatal(err) != tt.fatal {
+			t.Errorf("HTTP %d %q: got fatal %v, want %v", tt.status, tt.body, isFatal(err), tt.fatal)
+		}
+	}
+}
+
+func TestLookupAlbumStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		fatal    bool
+		requests int
+	}{
+		// The next variant is tried.
+		{http.StatusNotFound, false, 4},
+		{http.StatusInternalServerError, false, 4},
+		{http.StatusServiceUnavailable, false, 4},
+		// The lookup stops right away.
+		{http.StatusUnauthorized, true, 2},
+		{http.StatusForbidden, true, 2},
+		{http.StatusTooManyRequests, true, 2},
+	}
+	for _, tt := range tests {
+		wiki := newFakeWiki(
+			map[string][]string{
+				"Nevermind (Nirvana album)": {"Nevermind (Nirvana album)"},
+				"Nevermind (album)":         {"Nevermind"},
+			},
+			map[string]string{"Nevermind": "hlist-infobox"},
+		)
+		wiki.setStatus("Nevermind (Nirvana album)", tt.status)
+		genres, err := wiki.client().AlbumGenres("Nirvana", "Nevermind")
+		wiki.Close()
+		if tt.fatal {
+			if !isFatal(err) {
+				t.Errorf("HTTP %d: got genres %q and error %v, want a fatal error", tt.status, genres, err)
+			}
+		} else if want := []string{"Grunge", "Alternative Rock"}; err != nil || !reflect.DeepEqual(genres, want) {
+			t.Errorf("HTTP %d: got genres %q and error %v, want %q", tt.status, genres, err, want)
+		}
+		if n := wiki.requestCount(); n != tt.requests {
+			t.Errorf("HTTP %d: got %d requests, want %d", tt.status, n, tt.requests)
+		}
+	}
+}
+
+func TestLookupAlbumServerErrorOnly(t *testing.T) {
+	wiki := newFakeWiki(
+		map[string][]string{"Nevermind (Nirvana album)": {"Nevermind (Nirvana album)"}},
+		nil,
+	)
+	defer wiki.Close()
+	wiki.setStatus("Nevermind (Nirvana album)", http.StatusInternalServerError)
+	_, err := wiki.client().AlbumGenres("Nirvana", "Nevermind")
+	if e, ok := err.(*HTTPError); !ok || e.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got error %v, want HTTP 500 error", err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	wiki := nevermindWiki()
+	defer wiki.Close()
+	c := wiki.client(WithFallbackLanguages("de"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := map[string]func() error{
+		"crossWikiInfo": func() error {
+			_, err := c.crossWikiInfo(ctx, &AlbumInfo{URL: wiki.URL + "/wiki/Nevermind"})
+			return err
+		},
+		"redirectTitles": func() error {
+			_, err := c.redirectTitles(ctx, "Nevermind")
+			return err
+		},
+		"queryMusicBrainz": func() error {
+			var v interface{}
+			return c.queryMusicBrainz(ctx, "release", url.Values{}, &v)
+		},
+	}
+	for name, call := range calls {
+		if err := call(); err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Errorf("%s: got error %v, want %v", name, err, context.Canceled)
+		}
+	}
+	if n := wiki.requestCount(); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+}
+
+// logConcurrently logs an error and a warning from several goroutines at
+// once.
+func logConcurrently(l errorLogger) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := fmt.Sprintf("Artist %d - Album", i)
+			l.Error(query, ErrNoGenres)
+			l.Warning(query, "artist not mentioned")
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestColorErrorLoggerConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { colorStderr = w }(colorStderr)
+	colorStderr = &buf
+	logConcurrently(colorErrorLogger{})
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 16 {
+		t.Fatalf("got %d lines, want 16:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		reset := chalk.Reset.String()
+		if !strings.HasPrefix(line, "\u001b[3") || strings.Count(line, "\u001b[") != 1+strings.Count(reset, "\u001b[") || !strings.HasSuffix(line, reset) {
+			t.Errorf("got interleaved line %q", line)
+		}
+	}
+}
+
+func TestJSONErrorLoggerConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logConcurrently(newJSONErrorLogger(&buf))
+	dec := json.NewDecoder(&buf)
+	n := 0
+	for ; dec.More(); n++ {
+		var e jsonLogEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("entry %d: %v", n, err)
+		}
+	}
+	if n != 16 {
+		t.Errorf("got %d entries, want 16", n)
+	}
+}
+
+func TestResolveTitle(t *testing.T) {
+	normalized := []titleMapping{{"grunge", "Grunge"}, {"alternative_rock", "Alternative rock"}}
+	redirects := []titleMapping{{"Alternative rock", "Alternative rock music"}, {"Post grunge", "Post-grunge"}}
+	tests := []struct {
+		title, want string
+	}{
+		{"grunge", "Grunge"},
+		{"alternative_rock", "Alternative rock music"},
+		{"Post grunge", "Post-grunge"},
+		{"Noise rock", "Noise rock"},
+	}
+	for _, tt := range tests {
+		if got := resolveTitle(tt.title, normalized, redirects); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+// fixedSource is a rand.Source that always yields the same value.
+type fixedSource int64
+
+func (s fixedSource) Int63() int64 { return int64(s) }
+func (s fixedSource) Seed(int64)   {}
+
+func TestRetryWaitJitter(t *testing.T) {
+	// A power of two delay keeps halves of doubled delays powers of two, so
+	// that rand.Int63n takes the value of the source as is, masked.
+	const delay = 1024 * time.Nanosecond
+	tests := []struct {
+		src  rand.Source
+		want []time.Duration
+	}{
+		// The lower bound is half the delay.
+		{fixedSource(0), []time.Duration{512, 1024, 2048, 4096}},
+		// The upper bound is just under the delay.
+		{fixedSource(1<<63 - 1), []time.Duration{1023, 2047, 4095, 8191}},
+	}
+	for _, tt := range tests {
+		c := NewClient(WithRetries(len(tt.want), delay), WithJitterSource(tt.src))
+		for i, want := range tt.want {
+			if got := c.retryWait(i + 1); got != want {
+				t.Errorf("source %v, attempt %d: got %s, want %s", tt.src, i+1, got, want)
+			}
+		}
+	}
+
+	// The same seed yields the same delays.
+	c1 := NewClient(WithRetries(4, time.Second), WithJitterSource(rand.NewSource(1)))
+	c2 := NewClient(WithRetries(4, time.Second), WithJitterSource(rand.NewSource(1)))
+	for attempt := 1; attempt <= 4; attempt++ {
+		d := time.Second << uint(attempt-1)
+		w1, w2 := c1.retryWait(attempt), c2.retryWait(attempt)
+		if w1 != w2 {
+			t.Errorf("attempt %d: got %s and %s with the same seed", attempt, w1, w2)
+		}
+		if w1 < d/2 || w1 >= d {
+			t.Errorf("attempt %d: got %s, want between %s and %s", attempt, w1, d/2, d)
+		}
+	}
+}
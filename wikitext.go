@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScrapeStrategy tells how album pages are scraped.
+type ScrapeStrategy string
+
+// Scrape strategies.
+const (
+	// ScrapeHTML scrapes rendered article pages with CSS selectors.
+	ScrapeHTML ScrapeStrategy = "html"
+	// ScrapeWikitext parses parameters of the infobox template from the
+	// article source, which doesn't depend on how the article is rendered.
+	ScrapeWikitext ScrapeStrategy = "wikitext"
+)
+
+// WithScrapeStrategy sets how album pages are scraped. Defaults to
+// ScrapeHTML. With ScrapeWikitext, only genres, title, release type and date
+// are scraped, and genres always come from the infobox.
+func WithScrapeStrategy(strategy ScrapeStrategy) Option {
+	return func(c *Client) {
+		c.scrapeStrategy = strategy
+	}
+}
+
+// wikitextInfo scrapes the infobox template of the article at uri.
+func (c *Client) wikitextInfo(ctx context.Context, uri string) (*AlbumInfo, error) {
+	var resp struct {
+		Parse struct {
+			Title    string
+			Wikitext struct {
+				Text string `json:"*"`
+			}
+		}
+	}
+	err := c.queryAPI(ctx, c.baseURL, url.Values{
+		"action":    {"parse"},
+		"page":      {articleTitle(uri)},
+		"prop":      {"wikitext"},
+		"redirects": {"1"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	text := resp.Parse.Wikitext.Text
+	info := &AlbumInfo{
+		Title:    resp.Parse.Title,
+		URL:      uri,
+		Type:     templateParam(text, "type"),
+		Released: wikitextPlain(templateParam(text, "released")),
+	}
+	for _, label := range c.genreLabels {
+		info.Genres = wikitextValues(templateParam(text, label))
+		if len(info.Genres) > 0 {
+			info.Source = SourceInfobox
+			info.Confidence = info.Source.Confidence()
+			break
+		}
+	}
+	if year := reYear.FindString(info.Released); year != "" {
+		info.Year, _ = strconv.Atoi(year)
+	}
+	c.metrics.Observe("genres", float64(len(info.Genres)))
+	return info, nil
+}
+
+var (
+	reWikiComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	reWikiRef     = regexp.MustCompile(`(?is)<ref[^>/]*/>|<ref[^>]*>.*?</ref>`)
+	reWikiLink    = regexp.MustCompile(`\[\[([^\]|]+)(?:\|([^\]]+))?\]\]`)
+	reWikiMarkup  = regexp.MustCompile(`\{\{|\}\}|\[\[|\]\]|'''|''|<[^>]+>`)
+)
+
+// templateParam returns the raw value of template parameter name, e.g.
+// "[[Grunge]], [[alternative rock]]" for "| genre = [[Grunge]], [[alternative
+// rock]]". Parameter names are matched ignoring case. Comments and references
+// are removed.
+func templateParam(text, name string) string {
+	text = reWikiComment.ReplaceAllString(text, "")
+	text = reWikiRef.ReplaceAllString(text, "")
+	re := regexp.MustCompile(`(?im)^\s*\|\s*` + regexp.QuoteMeta(name) + `\s*=`)
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return ""
+	}
+	value := text[loc[1]:]
+	// The value lasts until the next parameter or the end of the template,
+	// not counting ones of nested templates like {{hlist|...}}.
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "{{"), strings.HasPrefix(value[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(value[i:], "}}"), strings.HasPrefix(value[i:], "]]"):
+			if depth == 0 {
+				return strings.TrimSpace(value[:i])
+			}
+			depth--
+			i++
+		case value[i] == '|' && depth == 0:
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// wikitextValues returns link texts of wikitext value, or the value split on
+// commas and list markup if it has no links.
+func wikitextValues(value string) []string {
+	var result []string
+	for _, m := range reWikiLink.FindAllStringSubmatch(value, -1) {
+		text := m[2]
+		if text == "" {
+			text = m[1]
+		}
+		if strings.Contains(m[1], ":") {
+			continue // files and categories
+		}
+		result = append(result, strings.TrimSpace(text))
+	}
+	if len(result) > 0 {
+		return result
+	}
+	value = reWikiMarkup.ReplaceAllString(value, ",")
+	for _, sep := range []string{"\n", "*", "•", "|"} {
+		value = strings.Replace(value, sep, ",", -1)
+	}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" && !strings.EqualFold(part, "hlist") && !strings.EqualFold(part, "flatlist") {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+var reStartDate = regexp.MustCompile(`(?i)\{\{\s*(?:start|release) date[^|}]*\|(?:[a-z]+=[^|}]*\|)*(\d{4})(?:\|(\d{1,2}))?(?:\|(\d{1,2}))?[^}]*\}\}`)
+
+// wikitextPlain strips markup from wikitext value, keeping link texts. Date
+// templates like {{Start date|1991|9|24}} are turned into "1991-9-24".
+func wikitextPlain(value string) string {
+	value = reStartDate.ReplaceAllStringFunc(value, func(date string) string {
+		m := reStartDate.FindStringSubmatch(date)
+		parts := []string{m[1]}
+		for _, part := range m[2:] {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "-")
+	})
+	value = reWikiLink.ReplaceAllStringFunc(value, func(link string) string {
+		m := reWikiLink.FindStringSubmatch(link)
+		if m[2] != "" {
+			return m[2]
+		}
+		return m[1]
+	})
+	value = reWikiMarkup.ReplaceAllString(value, " ")
+	return strings.Join(strings.Fields(value), " ")
+}
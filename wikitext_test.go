@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const nevermindWikitext = `{{Short description|1991 studio album by Nirvana}}
+{{Infobox album
+| name       = Nevermind
+| type       = studio
+| artist     = [[Nirvana (band)|Nirvana]]
+| cover      = NirvanaNevermindalbumcover.jpg
+| released   = {{Start date|1991|9|24}}<ref name="release">{{cite web|url=https://example.com|title=Release}}</ref>
+| recorded   = May–June 1991
+| genre      = {{hlist|[[Grunge]]|[[alternative rock]]<ref>{{cite book|title=Grunge|page=12}}</ref>}}<!-- Don't add genres without a source -->
+| length     = 49:23
+| label      = [[DGC Records|DGC]]
+| producer   = {{flatlist|
+* [[Butch Vig]]
+* [[Kurt Cobain]]
+}}
+| prev_title = [[Bleach (Nirvana album)|Bleach]]
+}}
+'''''Nevermind''''' is the second studio album by the American rock band [[Nirvana (band)|Nirvana]].`
+
+func TestTemplateParam(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"type", "studio"},
+		{"Type", "studio"},
+		{"artist", "[[Nirvana (band)|Nirvana]]"},
+		{"released", "{{Start date|1991|9|24}}"},
+		{"genre", "{{hlist|[[Grunge]]|[[alternative rock]]}}"},
+		{"producer", "{{flatlist|\n* [[Butch Vig]]\n* [[Kurt Cobain]]\n}}"},
+		{"prev_title", "[[Bleach (Nirvana album)|Bleach]]"},
+		{"genres", ""},
+		{"cover", "NirvanaNevermindalbumcover.jpg"},
+	}
+	for _, tt := range tests {
+		if got := templateParam(nevermindWikitext, tt.name); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateParamMissingGenre(t *testing.T) {
+	text := "{{Infobox album\n| name = Nevermind\n<!-- | genre = [[Grunge]] -->\n| label = [[DGC Records|DGC]]\n}}"
+	if got := templateParam(text, "genre"); got != "" {
+		t.Errorf("got %q, want none", got)
+	}
+	if got := wikitextValues(templateParam(text, "genre")); got != nil {
+		t.Errorf("got genres %q, want none", got)
+	}
+}
+
+func TestWikitextValues(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"[[Grunge]], [[alternative rock]]", []string{"Grunge", "alternative rock"}},
+		{"[[Alternative rock|alt rock]]", []string{"alt rock"}},
+		{"{{hlist|[[Grunge]]|[[alternative rock]]}}", []string{"Grunge", "alternative rock"}},
+		{"{{flatlist|\n* [[Grunge]]\n* [[Noise rock|noise]]\n}}", []string{"Grunge", "noise"}},
+		{"[[File:Cover.jpg|thumb]] [[Grunge]]", []string{"Grunge"}},
+		{"Grunge, alternative rock", []string{"Grunge", "alternative rock"}},
+		{"{{hlist|Grunge|alternative rock}}", []string{"Grunge", "alternative rock"}},
+		{"* Grunge\n* Noise rock", []string{"Grunge", "Noise rock"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := wikitextValues(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWikitextPlain(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"{{Start date|1991|9|24}}", "1991-9-24"},
+		{"{{Start date|df=yes|1991|9|24}}", "1991-9-24"},
+		{"{{release date|1991}}", "1991"},
+		{"September 24, 1991", "September 24, 1991"},
+		{"[[Nirvana (band)|Nirvana]]", "Nirvana"},
+		{"''[[Nevermind]]''", "Nevermind"},
+		{"May 1991<br />June 1991", "May 1991 June 1991"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := wikitextPlain(tt.value); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}